@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	asg "elevator/assigner"
+	"elevator/elevio"
+	"elevator/logging"
+	"elevator/metrics"
+	sts "elevator/statesync"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Controller is the part of the local elevator controller exposed over HTTP.
+type Controller interface {
+	// Status returns the local elevator state, consistent at one instant.
+	Status() ElevatorStatus
+	// Faults returns the most recent faults, oldest first.
+	Faults() []Fault
+	// InjectCall handles `b` as if its button was pressed.
+	InjectCall(b elevio.ButtonEvent)
+	// SetOutOfService takes the elevator out of service or back into service.
+	SetOutOfService(outOfService bool)
+	// Peers returns the membership and last received state of every elevator.
+	Peers() []PeerStatus
+	// AliveElevatorIDs returns the IDs of all alive elevators.
+	AliveElevatorIDs() []int
+	// PendingAssignments returns the hall calls we assigned which have not been served yet.
+	PendingAssignments() []asg.Assignment
+}
+
+// ElevatorStatus is the state of the local elevator.
+type ElevatorStatus struct {
+	ID             int       `json:"id"`
+	Behaviour      string    `json:"behaviour"`
+	Floor          int       `json:"floor"`
+	Direction      string    `json:"direction"`
+	DoorObstructed bool      `json:"doorObstructed"`
+	Availability   string    `json:"availability"`
+	OutOfService   bool      `json:"outOfService"`
+	Offline        bool      `json:"offline"`
+	Requests       [][3]bool `json:"requests"`
+}
+
+// Fault is an error reported by the elevator at `Time`.
+type Fault struct {
+	Time        time.Time `json:"time"`
+	Description string    `json:"description"`
+}
+
+// PeerStatus is the state of an elevator as received by statesync.
+type PeerStatus struct {
+	ID            int       `json:"id"`
+	Status        string    `json:"status"`
+	Availability  string    `json:"availability"`
+	Incarnation   uint32    `json:"incarnation"`
+	Phi           float64   `json:"phi"`
+	JoinedAt      time.Time `json:"joinedAt"`
+	LastSeen      time.Time `json:"lastSeen"`
+	Floor         *int      `json:"floor,omitempty"`
+	Direction     string    `json:"direction,omitempty"`
+	Behaviour     string    `json:"behaviour,omitempty"`
+	DoorOpen      bool      `json:"doorOpen,omitempty"`
+	Obstructed    bool      `json:"obstructed,omitempty"`
+	BetweenFloors bool      `json:"betweenFloors,omitempty"`
+	Capacity      int       `json:"capacity,omitempty"`
+	Requests      [][3]bool `json:"requests,omitempty"`
+}
+
+type callRequest struct {
+	Floor  int    `json:"floor"`
+	Button string `json:"button"`
+}
+
+type outOfServiceRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type logLevelRequest struct {
+	Subsystem string `json:"subsystem"`
+	Level     string `json:"level"`
+}
+
+var _log = logging.For("api")
+
+// Time open requests get to finish once the server shuts down.
+const shutdownTimeout = 2 * time.Second
+
+var buttonNames = map[string]elevio.ButtonType{
+	"hall_up":   elevio.BT_HallUp,
+	"hall_down": elevio.BT_HallDown,
+	"cab":       elevio.BT_Cab,
+}
+
+// NewHandler returns the handler serving the status and control API of `ctl`.
+func NewHandler(ctl Controller, numFloors int) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.Status())
+	})
+	mux.HandleFunc("GET /api/requests", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.Status().Requests)
+	})
+	mux.HandleFunc("GET /api/faults", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.Faults())
+	})
+	mux.HandleFunc("GET /api/peers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.Peers())
+	})
+	mux.HandleFunc("GET /api/alive", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.AliveElevatorIDs())
+	})
+	mux.HandleFunc("GET /api/assignments", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.PendingAssignments())
+	})
+
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	mux.HandleFunc("POST /api/calls", func(w http.ResponseWriter, r *http.Request) {
+		var req callRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		button, exists := buttonNames[req.Button]
+		if !exists {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unknown button %q", req.Button))
+			return
+		}
+		if req.Floor < 0 || req.Floor >= numFloors {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("floor %d out of range", req.Floor))
+			return
+		}
+
+		ctl.InjectCall(elevio.ButtonEvent{Floor: req.Floor, Button: button})
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("POST /api/out-of-service", func(w http.ResponseWriter, r *http.Request) {
+		var req outOfServiceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctl.SetOutOfService(req.Enabled)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("POST /api/log-level", func(w http.ResponseWriter, r *http.Request) {
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		logging.SetLevel(req.Subsystem, level)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+// Serve starts serving `handler` on `addr` in the background until `ctx` is done. Returns an
+// error if `addr` cannot be listened on.
+func Serve(ctx context.Context, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	// Requests inherit `ctx`, so streams end when the server shuts down
+	server := &http.Server{Handler: handler, BaseContext: func(net.Listener) context.Context { return ctx }}
+
+	go func() {
+		_log.Info("serving API", "addr", addr)
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			_log.Error("API server stopped", "err", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			_log.Warn("API server did not shut down in time", "err", err)
+		}
+	}()
+	return nil
+}
+
+// DirectionName returns the API representation of `d`.
+func DirectionName(d elevio.MotorDirection) string {
+	switch d {
+	case elevio.MD_Up:
+		return "up"
+	case elevio.MD_Down:
+		return "down"
+	}
+	return "stop"
+}
+
+// PeerStatuses collects the membership and last received state of every elevator known to `s`,
+// all taken at one instant.
+func PeerStatuses(s *sts.Sync) []PeerStatus {
+	view := s.Snapshot()
+	peers := make([]PeerStatus, 0, len(view.Members))
+	for _, m := range view.Members {
+		peer := PeerStatus{
+			ID:           m.ID,
+			Status:       m.Status.String(),
+			Availability: view.Availability(m.ID).String(),
+			Incarnation:  m.Incarnation,
+			Phi:          math.Min(m.Phi, math.MaxFloat64),
+			JoinedAt:     m.JoinedAt,
+			LastSeen:     m.LastSeen,
+		}
+		if state := view.State(m.ID); state != nil {
+			floor := state.GetFloor()
+			peer.Floor = &floor
+			peer.Direction = DirectionName(state.GetDirection())
+			peer.Behaviour = state.GetBehaviour().String()
+			peer.DoorOpen = state.IsDoorOpen()
+			peer.Obstructed = state.IsObstructed()
+			peer.BetweenFloors = state.IsBetweenFloors()
+			peer.Capacity = state.GetCapacity()
+			peer.Requests = state.GetRequests()
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	asg "elevator/assigner"
+	"elevator/elevio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeController struct {
+	status       ElevatorStatus
+	calls        []elevio.ButtonEvent
+	outOfService bool
+}
+
+func (f *fakeController) Status() ElevatorStatus            { return f.status }
+func (f *fakeController) Faults() []Fault                   { return []Fault{{Description: "Elevator stuck"}} }
+func (f *fakeController) InjectCall(b elevio.ButtonEvent)   { f.calls = append(f.calls, b) }
+func (f *fakeController) SetOutOfService(outOfService bool) { f.outOfService = outOfService }
+func (f *fakeController) Peers() []PeerStatus               { return nil }
+func (f *fakeController) AliveElevatorIDs() []int           { return []int{f.status.ID} }
+func (f *fakeController) PendingAssignments() []asg.Assignment {
+	return nil
+}
+
+func request(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func TestAPI_State(t *testing.T) {
+	ctl := &fakeController{status: ElevatorStatus{ID: 1, Behaviour: "idle", Floor: 2, Requests: [][3]bool{{true, false, false}}}}
+	handler := NewHandler(ctl, 4)
+
+	rec := request(handler, http.MethodGet, "/api/state", "")
+	var status ElevatorStatus
+	json.NewDecoder(rec.Body).Decode(&status)
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(status, ctl.status) {
+		t.Errorf("State not as expected.\nExpected: %+v\nWas: %d %+v", ctl.status, rec.Code, status)
+	}
+
+	rec = request(handler, http.MethodGet, "/api/faults", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Elevator stuck") {
+		t.Errorf("Faults not as expected, was %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPI_InjectCalls(t *testing.T) {
+	ctl := &fakeController{}
+	handler := NewHandler(ctl, 4)
+
+	if rec := request(handler, http.MethodPost, "/api/calls", `{"floor": 3, "button": "hall_down"}`); rec.Code != http.StatusAccepted {
+		t.Errorf("Expected call to be accepted, was %d", rec.Code)
+	}
+	if rec := request(handler, http.MethodPost, "/api/calls", `{"floor": 4, "button": "cab"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected call to non existing floor to be rejected, was %d", rec.Code)
+	}
+	if rec := request(handler, http.MethodPost, "/api/calls", `{"floor": 0, "button": "sideways"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected call of unknown button to be rejected, was %d", rec.Code)
+	}
+
+	expected := []elevio.ButtonEvent{{Floor: 3, Button: elevio.BT_HallDown}}
+	if !reflect.DeepEqual(ctl.calls, expected) {
+		t.Errorf("Injected calls not as expected.\nExpected: %+v\nWas: %+v", expected, ctl.calls)
+	}
+}
+
+func TestAPI_OutOfService(t *testing.T) {
+	ctl := &fakeController{}
+	handler := NewHandler(ctl, 4)
+
+	if rec := request(handler, http.MethodPost, "/api/out-of-service", `{"enabled": true}`); rec.Code != http.StatusAccepted || !ctl.outOfService {
+		t.Errorf("Expected elevator to be taken out of service, was %d", rec.Code)
+	}
+	if rec := request(handler, http.MethodGet, "/api/out-of-service", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rejected, was %d", rec.Code)
+	}
+}
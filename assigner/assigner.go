@@ -1,37 +1,64 @@
 package assigner
 
 import (
+	"context"
+	"elevator/clock"
 	"elevator/elevio"
+	"elevator/logging"
 	"elevator/statesync"
+	"elevator/transport"
+	"elevator/types"
 	"encoding/binary"
-	"fmt"
-	"log"
-	"net"
-	"reflect"
+	"io"
+	"slices"
+	"sync"
 	"time"
 )
 
-const broadcastAddr = "255.255.255.255"
-const broadcastPort = "49235"
+// BroadcastPort is the port assignments are broadcast on.
+const BroadcastPort = "49235"
 const transmissionBatchSize = 10
+const confirmTimeout = 1 * time.Second
 
-var _initialized bool
-var _elevatorID int
-var _nonce int
-var _assignmentChan chan elevio.ButtonEvent
-var _elevatorNonces map[int]int
+var _log = logging.For("assigner")
 
-func Init(elevatorID int, assignmentChan chan elevio.ButtonEvent) {
-	if _initialized {
-		fmt.Println("assigner already initialized!")
-		return
+// Assigner assigns hall calls to the cheapest elevator and receives the assignments of others.
+type Assigner struct {
+	mtx            sync.Mutex
+	elevatorID     int
+	numFloors      int
+	transport      transport.Transport
+	sync           *statesync.Sync
+	clock          clock.Clock
+	metrics        *assignerMetrics
+	nonce          int
+	assignmentChan chan elevio.ButtonEvent
+	elevatorNonces map[int]int
+	pending        []Assignment
+}
+
+// New prepares the assigner of elevator `elevatorID` serving `numFloors` floors, which picks
+// elevators from the states of `sync`. Assignments are exchanged over `tr` and assignments for
+// this elevator are forwarded to `assignmentChan`.
+func New(elevatorID int, numFloors int, tr transport.Transport, sync *statesync.Sync, clk clock.Clock, assignmentChan chan elevio.ButtonEvent) *Assigner {
+	return &Assigner{
+		elevatorID:     elevatorID,
+		numFloors:      numFloors,
+		transport:      tr,
+		sync:           sync,
+		clock:          clk,
+		metrics:        newAssignerMetrics(elevatorID),
+		assignmentChan: assignmentChan,
+		elevatorNonces: make(map[int]int),
 	}
-	_elevatorID = elevatorID
-	_nonce = 0
-	_assignmentChan = assignmentChan
-	_elevatorNonces = make(map[int]int)
+}
 
-	_initialized = true
+// Assignment is a hall call this elevator assigned to elevator `AssigneeID`.
+type Assignment struct {
+	AssigneeID int                `json:"assigneeId"`
+	Button     elevio.ButtonEvent `json:"button"`
+	AssignedAt time.Time          `json:"assignedAt"`
+	Confirmed  bool               `json:"confirmed"` // whether the assignee holds the hall call
 }
 
 type assignment struct {
@@ -42,82 +69,172 @@ type assignment struct {
 }
 
 // ReceiveAssignments starts listening for assignments for this elevator
-// and forwards them to to assignment channel.
-func ReceiveAssignments() {
-	var conn *net.UDPConn
+// and forwards them to to assignment channel until `ctx` is done.
+func (a *Assigner) ReceiveAssignments(ctx context.Context) {
+	var conn io.ReadCloser
 
 	for {
 		var err error
-		addr, _ := net.ResolveUDPAddr("udp", broadcastAddr+":"+broadcastPort)
-		conn, err = net.ListenUDP("udp", addr)
+		conn, err = a.transport.Listen(BroadcastPort)
 
 		if err == nil {
 			break
 		}
-		time.Sleep(1 * time.Second)
+		if !clock.SleepContext(ctx, a.clock, 1*time.Second) {
+			return
+		}
 	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() }) // unblocks Read
+	defer stop()
 	defer conn.Close()
 
 	buf := make([]byte, 128)
 	for {
-		n, _, err := conn.ReadFromUDP(buf)
+		n, err := conn.Read(buf)
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			continue
 		}
+		if n != assignmentLength {
+			continue
+		}
 		assignment := deserialize(buf[:n])
-		if assignment.assigneeID != _elevatorID {
+		if assignment.assigneeID != a.elevatorID {
+			continue
+		}
+		if !IsHallCall(assignment.button, a.numFloors) {
+			_log.Warn("dropping assignment which is no hall call of ours", "call", assignment.button, "assigner", assignment.assignerID)
 			continue
 		}
 
 		// deduplication
-		assignerNonce, exists := _elevatorNonces[assignment.assignerID]
+		assignerNonce, exists := a.elevatorNonces[assignment.assignerID]
 		if !exists || assignerNonce < assignment.nonce {
-			_assignmentChan <- assignment.button
-			_elevatorNonces[assignment.assignerID] = assignment.nonce
+			a.metrics.assignmentsReceived.Inc()
+			select {
+			case a.assignmentChan <- assignment.button:
+			case <-ctx.Done():
+				return
+			}
+			a.elevatorNonces[assignment.assignerID] = assignment.nonce
+		} else {
+			a.metrics.assignmentsDuplicated.Inc()
 		}
 	}
+}
 
+// IsHallCall reports whether `b` is a hall button at one of `numFloors` floors. Calls received
+// over the network must be checked before they index requests.
+func IsHallCall(b elevio.ButtonEvent, numFloors int) bool {
+	return b.Floor >= 0 && b.Floor < numFloors && (b.Button == elevio.BT_HallUp || b.Button == elevio.BT_HallDown)
 }
 
 // Assign finds the cheapest elevator for handling a `request`. This information gets broadcast.
 // Returns the ID of the cheapest elevator.
-func Assign(request elevio.ButtonEvent) int {
-	assigneeID := cost(request)
-	log.Printf("Assigning call to elevator %d", assigneeID)
+func (a *Assigner) Assign(request elevio.ButtonEvent) int {
+	assigneeID := a.cost(request)
+	_log.Info("assigning call", "call", request, "assignee", assigneeID)
 
-	addr := broadcastAddr + ":" + broadcastPort
-	conn, err := net.Dial("udp", addr)
+	conn, err := a.transport.Dial(BroadcastPort)
 	if err != nil {
-		log.Printf("UDP error: %v", err)
+		_log.Error("transport error", "err", err)
 		return assigneeID
 	}
 	defer conn.Close()
 
 	assignment := assignment{
 		assigneeID: assigneeID,
-		assignerID: _elevatorID,
+		assignerID: a.elevatorID,
 		button:     request,
-		nonce:      _nonce,
+		nonce:      a.nonce,
 	}
-	_nonce++
+	a.nonce++
+	a.metrics.assignmentsSent.Inc()
 
 	for range transmissionBatchSize {
 		conn.Write(serialize(assignment))
 	}
 
+	confirmed := a.holds(assigneeID, request)
+	a.mtx.Lock()
+	a.pending = append(a.pending, Assignment{assigneeID, request, a.clock.Now(), confirmed})
+	a.mtx.Unlock()
+
 	return assigneeID
 }
 
-// cost returns the ID of the best currently available elevator for the given call.
-func cost(call elevio.ButtonEvent) int {
-	aliveElevators := statesync.GetAliveElevatorIDs()
+// TrackAssignments follows the changes of the states of all elevators to tell when our pending
+// assignments are confirmed and served until `ctx` is done or the state sync stopped.
+func (a *Assigner) TrackAssignments(ctx context.Context) {
+	changes := a.sync.Subscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			a.track(change)
+		}
+	}
+}
+
+// Updates the pending assignments affected by `change`.
+func (a *Assigner) track(change statesync.Change) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	switch change.Kind {
+	case statesync.CK_RequestAdded:
+		for i, p := range a.pending {
+			if p.AssigneeID == change.ElevatorID && p.Button == change.Request {
+				a.pending[i].Confirmed = true
+			}
+		}
+	case statesync.CK_RequestCleared:
+		a.pending = slices.DeleteFunc(a.pending, func(p Assignment) bool {
+			return p.Confirmed && p.AssigneeID == change.ElevatorID && p.Button == change.Request
+		})
+	case statesync.CK_PeerFailed, statesync.CK_PeerLeft:
+		a.pending = slices.DeleteFunc(a.pending, func(p Assignment) bool {
+			return p.AssigneeID == change.ElevatorID
+		})
+	}
+}
+
+// GetPendingAssignments returns the assignments made by this elevator which have not been served yet.
+// An assignment is served once the assignee confirmed it in its state and cleared it again, or if
+// the assignee never confirmed it within `confirmTimeout`. Assignments of failed and departed elevators got reassigned.
+func (a *Assigner) GetPendingAssignments() []Assignment {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.pending = slices.DeleteFunc(a.pending, func(p Assignment) bool {
+		return !p.Confirmed && a.clock.Since(p.AssignedAt) >= confirmTimeout
+	})
+	return slices.Clone(a.pending)
+}
+
+// Reports whether the last state received from elevator `id` holds `request`.
+func (a *Assigner) holds(id int, request elevio.ButtonEvent) bool {
+	state := a.sync.GetState(id)
+	return state != nil && state.GetRequests()[request.Floor][request.Button]
+}
+
+// cost returns the ID of the best currently available elevator for the given call, judged from
+// one snapshot of all elevators.
+func (a *Assigner) cost(call elevio.ButtonEvent) int {
+	view := a.sync.Snapshot()
 
 	lowestcost := 1000
-	lowestcostID := _elevatorID
+	lowestcostID := a.elevatorID
 
-	for _, elevatorID := range aliveElevators {
-		state := statesync.GetState(elevatorID)
-		if state == nil || reflect.ValueOf(state).IsNil() {
+	for _, elevatorID := range view.Alive() {
+		state := view.State(elevatorID)
+		if state == nil || state.GetAvailability() != types.AV_Available {
 			continue
 		}
 		cost := 0
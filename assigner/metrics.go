@@ -0,0 +1,23 @@
+package assigner
+
+import (
+	"elevator/metrics"
+	"strconv"
+)
+
+// assignerMetrics are the metrics of the assigner of one elevator, labelled with its ID since
+// several elevators may run in one process.
+type assignerMetrics struct {
+	assignmentsSent       *metrics.Counter
+	assignmentsReceived   *metrics.Counter
+	assignmentsDuplicated *metrics.Counter
+}
+
+func newAssignerMetrics(elevatorID int) *assignerMetrics {
+	id := strconv.Itoa(elevatorID)
+	return &assignerMetrics{
+		assignmentsSent:       metrics.NewCounter("elevator_assigner_assignments_sent_total", "Hall calls assigned by this elevator.", "elevator", id),
+		assignmentsReceived:   metrics.NewCounter("elevator_assigner_assignments_received_total", "Assignments for this elevator forwarded to the controller.", "elevator", id),
+		assignmentsDuplicated: metrics.NewCounter("elevator_assigner_assignments_duplicated_total", "Assignments for this elevator dropped as duplicates.", "elevator", id),
+	}
+}
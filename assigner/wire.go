@@ -0,0 +1,40 @@
+package assigner
+
+import (
+	"elevator/elevio"
+	"fmt"
+)
+
+const assignmentLength = 8
+
+// Message is an assignment as sent on the network, for tools listening to the cluster.
+type Message struct {
+	AssigneeID int
+	AssignerID int
+	Button     elevio.ButtonEvent
+	Nonce      int
+}
+
+// EncodeMessage serializes `m` in the assignment wire format.
+func EncodeMessage(m Message) []byte {
+	return serialize(assignment{
+		assigneeID: m.AssigneeID,
+		assignerID: m.AssignerID,
+		button:     m.Button,
+		nonce:      m.Nonce,
+	})
+}
+
+// DecodeMessage deserializes an assignment received on `BroadcastPort`.
+func DecodeMessage(b []byte) (Message, error) {
+	if len(b) != assignmentLength {
+		return Message{}, fmt.Errorf("assignment of %d bytes, expected %d", len(b), assignmentLength)
+	}
+	a := deserialize(b)
+	return Message{
+		AssigneeID: a.assigneeID,
+		AssignerID: a.assignerID,
+		Button:     a.button,
+		Nonce:      a.nonce,
+	}, nil
+}
@@ -0,0 +1,22 @@
+package assigner
+
+import (
+	"elevator/elevio"
+	"reflect"
+	"testing"
+)
+
+func TestWire_RoundTrip(t *testing.T) {
+	m := Message{AssigneeID: 2, AssignerID: 1, Button: elevio.ButtonEvent{Floor: 3, Button: elevio.BT_HallDown}, Nonce: 70000}
+
+	result, err := DecodeMessage(EncodeMessage(m))
+	if err != nil || !reflect.DeepEqual(result, m) {
+		t.Errorf("Decoded assignment not as expected.\nExpected: %+v\nWas: %+v, %v", m, result, err)
+	}
+}
+
+func TestWire_RejectsMalformed(t *testing.T) {
+	if _, err := DecodeMessage([]byte{1, 2, 3}); err == nil {
+		t.Errorf("Expected truncated assignment to be rejected")
+	}
+}
@@ -0,0 +1,355 @@
+// Package chaos injects faults into running elevators: it kills or freezes nodes, impairs their
+// network, disconnects their driver, jams their motor or holds their obstruction switch, either
+// on a timeline in tests and simulations or on request through the control API.
+package chaos
+
+import (
+	"bufio"
+	asg "elevator/assigner"
+	"elevator/clock"
+	"elevator/elevio"
+	"elevator/logging"
+	sts "elevator/statesync"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	FK_Kill             Kind = "kill"              // the node goes silent and stops for good
+	FK_Freeze           Kind = "freeze"            // the main loop of the controller stalls
+	FK_DropPackets      Kind = "drop"              // datagrams on `Port` are dropped with probability `Rate`
+	FK_DelayPackets     Kind = "delay"             // datagrams sent on `Port` are delayed by `Delay`
+	FK_DisconnectDriver Kind = "disconnect_driver" // outputs to the elevator are lost, the floor sensor reads nothing
+	FK_JamMotor         Kind = "jam_motor"         // the motor does not move
+	FK_HoldObstruction  Kind = "hold_obstruction"  // the obstruction switch is on
+)
+
+// Ports of the subsystems whose datagrams can be impaired.
+var Ports = map[string]string{
+	"statesync": sts.BroadcastPort,
+	"assigner":  asg.BroadcastPort,
+}
+
+// forever is the duration of faults which are not lifted.
+const forever = 100 * 365 * 24 * time.Hour
+
+var _log = logging.For("chaos")
+
+// Fault is a fault of kind `Kind` injected into node `Node` at `At`, counted from the start of a
+// timeline, and lifted after `Duration`. A zero `Duration` keeps the fault until the node
+// restarts. `Port` names a key of `Ports`, or all of them if empty.
+type Fault struct {
+	At       time.Duration
+	Node     int
+	Kind     Kind
+	Duration time.Duration
+	Port     string
+	Rate     float64
+	Delay    time.Duration
+}
+
+// faultJSON is a fault as written in timelines and sent to the control API, e.g.
+// `{"at": "10s", "node": 1, "kind": "drop", "port": "statesync", "rate": 0.5, "duration": "30s"}`.
+type faultJSON struct {
+	At       string  `json:"at,omitempty"`
+	Node     int     `json:"node,omitempty"`
+	Kind     Kind    `json:"kind"`
+	Duration string  `json:"duration,omitempty"`
+	Port     string  `json:"port,omitempty"`
+	Rate     float64 `json:"rate,omitempty"`
+	Delay    string  `json:"delay,omitempty"`
+}
+
+func (f Fault) MarshalJSON() ([]byte, error) {
+	j := faultJSON{Node: f.Node, Kind: f.Kind, Port: f.Port, Rate: f.Rate}
+	for _, d := range []struct {
+		value time.Duration
+		text  *string
+	}{{f.At, &j.At}, {f.Duration, &j.Duration}, {f.Delay, &j.Delay}} {
+		if d.value != 0 {
+			*d.text = d.value.String()
+		}
+	}
+	return json.Marshal(j)
+}
+
+func (f *Fault) UnmarshalJSON(data []byte) error {
+	var j faultJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*f = Fault{Node: j.Node, Kind: j.Kind, Port: j.Port, Rate: j.Rate}
+	for _, d := range []struct {
+		text  string
+		value *time.Duration
+	}{{j.At, &f.At}, {j.Duration, &f.Duration}, {j.Delay, &f.Delay}} {
+		if d.text == "" {
+			continue
+		}
+		var err error
+		if *d.value, err = time.ParseDuration(d.text); err != nil {
+			return err
+		}
+	}
+	return f.validate()
+}
+
+func (f Fault) validate() error {
+	switch f.Kind {
+	case FK_Kill, FK_Freeze, FK_DisconnectDriver, FK_JamMotor, FK_HoldObstruction:
+	case FK_DropPackets:
+		if f.Rate <= 0 || f.Rate > 1 {
+			return fmt.Errorf("drop rate %v not in (0, 1]", f.Rate)
+		}
+	case FK_DelayPackets:
+		if f.Delay <= 0 {
+			return fmt.Errorf("delay must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown fault %q", f.Kind)
+	}
+	if _, exists := Ports[f.Port]; f.Port != "" && !exists {
+		return fmt.Errorf("unknown port %q", f.Port)
+	}
+	if f.At < 0 || f.Duration < 0 || f.Node < 0 {
+		return fmt.Errorf("negative time, duration or node")
+	}
+	return nil
+}
+
+func (f Fault) String() string {
+	s := fmt.Sprintf("%s node %d", f.Kind, f.Node)
+	if f.Port != "" {
+		s += " port " + f.Port
+	}
+	if f.Kind == FK_DropPackets {
+		s += fmt.Sprintf(" rate %v", f.Rate)
+	}
+	if f.Kind == FK_DelayPackets {
+		s += fmt.Sprintf(" delay %v", f.Delay)
+	}
+	if f.Duration > 0 {
+		s += fmt.Sprintf(" for %v", f.Duration)
+	}
+	return s
+}
+
+// Node is an elevator faults can be injected into. Its controller must use `Transport` and `Driver`.
+type Node struct {
+	Transport *Transport
+	Driver    *Driver
+	Clock     clock.Clock
+	Freeze    func(d time.Duration) // stalls the main loop of the controller for `d`
+	Obstruct  func(obstructed bool) // flips the obstruction switch
+	Exit      func()                // ends the process on kill, if set
+
+	mtx     sync.Mutex
+	active  []activeFault
+	killed  time.Time
+	lifts   map[int]clock.Timer // pending lifts of faults by sequence number
+	lifted  int                 // sequence number of the last lift scheduled
+	stopped bool
+}
+
+type activeFault struct {
+	Fault
+	until time.Time // zero if the fault is never lifted
+}
+
+// Inject injects `f` now and lifts it after its duration. Of overlapping faults of the same
+// kind, the first one lifted lifts all.
+func (n *Node) Inject(f Fault) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+	_log.Warn("injecting fault", "fault", f)
+
+	n.mtx.Lock()
+	if n.stopped {
+		n.mtx.Unlock()
+		return errors.New("node stopped")
+	}
+	now := n.Clock.Now()
+	active := activeFault{Fault: f}
+	if f.Duration > 0 {
+		active.until = now.Add(f.Duration)
+	}
+	n.active = append(n.active, active)
+	if f.Kind == FK_Kill && n.killed.IsZero() {
+		n.killed = now
+	}
+	n.mtx.Unlock()
+
+	n.apply(f, true)
+	if f.Duration > 0 && f.Kind != FK_Kill && f.Kind != FK_Freeze {
+		n.scheduleLift(f)
+	}
+	return nil
+}
+
+// Lifts `f` after its duration unless the node stopped before.
+func (n *Node) scheduleLift(f Fault) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if n.stopped {
+		return
+	}
+	if n.lifts == nil {
+		n.lifts = make(map[int]clock.Timer)
+	}
+	n.lifted++
+	seq := n.lifted
+	n.lifts[seq] = n.Clock.AfterFunc(f.Duration, func() {
+		n.mtx.Lock()
+		delete(n.lifts, seq)
+		n.mtx.Unlock()
+
+		_log.Info("lifting fault", "fault", f)
+		n.apply(f, false)
+	})
+}
+
+// Stop lifts no more faults and rejects new ones, so nothing touches the driver or the transport
+// of the node any more. Must be called before they are closed. Does nothing if `n` is nil.
+func (n *Node) Stop() {
+	if n == nil {
+		return
+	}
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.stopped = true
+	for _, lift := range n.lifts {
+		lift.Stop()
+	}
+	n.lifts = nil
+}
+
+// Injects `f` if `on`, lifts it otherwise, unless the node stopped.
+func (n *Node) apply(f Fault, on bool) {
+	n.mtx.Lock()
+	if n.stopped {
+		n.mtx.Unlock()
+		return
+	}
+	n.switchFault(f, on)
+	n.mtx.Unlock()
+
+	// The car is stopped and everything disconnected before the process may exit
+	if f.Kind == FK_Kill && n.Exit != nil {
+		n.Exit()
+	}
+}
+
+// Switches `f` on or off. Must be called while holding `mtx`, so `Stop` waits for it.
+func (n *Node) switchFault(f Fault, on bool) {
+	switch f.Kind {
+	case FK_Kill:
+		n.Driver.SetMotorDirection(elevio.MD_Stop)
+		n.Driver.Disconnect(true)
+		n.Transport.Disconnect(true)
+		go n.Freeze(forever)
+	case FK_Freeze:
+		d := f.Duration
+		if d == 0 {
+			d = forever
+		}
+		go n.Freeze(d)
+	case FK_DropPackets, FK_DelayPackets:
+		imp := Impairment{}
+		if on && f.Kind == FK_DropPackets {
+			imp.DropRate = f.Rate
+		} else if on {
+			imp.Delay = f.Delay
+		}
+		for name, port := range Ports {
+			if f.Port == "" || f.Port == name {
+				n.Transport.Impair(port, imp)
+			}
+		}
+	case FK_DisconnectDriver:
+		n.Driver.Disconnect(on)
+	case FK_JamMotor:
+		n.Driver.Jam(on)
+	case FK_HoldObstruction:
+		go n.Obstruct(on)
+	}
+}
+
+// Faults returns the faults injected and not lifted yet.
+func (n *Node) Faults() []Fault {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	now := n.Clock.Now()
+	active := n.active[:0]
+	for _, f := range n.active {
+		if f.until.IsZero() || f.until.After(now) {
+			active = append(active, f)
+		}
+	}
+	n.active = active
+
+	faults := make([]Fault, len(active))
+	for i, f := range active {
+		faults[i] = f.Fault
+	}
+	return faults
+}
+
+// Killed returns when the node was killed, or false if it is alive.
+func (n *Node) Killed() (time.Time, bool) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	return n.killed, !n.killed.IsZero()
+}
+
+// Timeline is a script of faults, each injected into its node at its time.
+type Timeline []Fault
+
+// ReadTimeline parses a JSONL timeline with one fault per line. Blank lines and lines starting
+// with `#` are skipped.
+func ReadTimeline(r io.Reader) (Timeline, error) {
+	var t Timeline
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var f Fault
+		if err := json.Unmarshal([]byte(text), &f); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		t = append(t, f)
+	}
+	sort.SliceStable(t, func(i, j int) bool { return t[i].At < t[j].At })
+	return t, scanner.Err()
+}
+
+// Start schedules every fault of `t` on `nodes` by `clk`, counted from now.
+func (t Timeline) Start(nodes []*Node, clk clock.Clock) error {
+	for _, f := range t {
+		if f.Node >= len(nodes) {
+			return fmt.Errorf("%s: no node %d", f, f.Node)
+		}
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+	}
+	for _, f := range t {
+		node := nodes[f.Node]
+		clk.AfterFunc(f.At, func() { node.Inject(f) })
+	}
+	return nil
+}
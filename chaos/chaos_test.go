@@ -0,0 +1,232 @@
+package chaos
+
+import (
+	"context"
+	"elevator/clock"
+	"elevator/elevio"
+	"elevator/transport"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+func TestTransport_DropsDelaysAndDisconnects(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	tr := NewTransport(network.Node(0), clk, 1)
+	r, _ := network.Node(1).Listen("1")
+	conn, _ := tr.Dial("1")
+
+	received := func() int {
+		count := 0
+		buf := make([]byte, 8)
+		done := make(chan struct{})
+		go func() {
+			for {
+				if _, err := r.Read(buf); err != nil {
+					close(done)
+					return
+				}
+				count++
+			}
+		}()
+		time.Sleep(10 * time.Millisecond)
+		r.Close()
+		<-done
+		r, _ = network.Node(1).Listen("1")
+		return count
+	}
+
+	tr.Impair("1", Impairment{DropRate: 1})
+	conn.Write([]byte{1})
+	if n := received(); n != 0 {
+		t.Errorf("Expected all datagrams to be dropped, received %d", n)
+	}
+
+	tr.Impair("1", Impairment{Delay: time.Second})
+	conn.Write([]byte{2})
+	clk.Advance(999 * time.Millisecond)
+	if n := received(); n != 0 {
+		t.Errorf("Expected the datagram to be delayed, received %d", n)
+	}
+	clk.Advance(time.Millisecond)
+	if n := received(); n != 1 {
+		t.Errorf("Expected the delayed datagram after the delay, received %d", n)
+	}
+
+	tr.Impair("1", Impairment{})
+	tr.Disconnect(true)
+	if _, err := conn.Write([]byte{3}); err != transport.ErrDisconnected {
+		t.Errorf("Expected writes of a disconnected node to fail, was %v", err)
+	}
+}
+
+// recordingDriver records the motor direction of an elevator standing at floor 1.
+type recordingDriver struct {
+	direction elevio.MotorDirection
+	doorOpen  bool
+}
+
+func (d *recordingDriver) SetMotorDirection(dir elevio.MotorDirection)                   { d.direction = dir }
+func (d *recordingDriver) SetButtonLamp(button elevio.ButtonType, floor int, value bool) {}
+func (d *recordingDriver) SetFloorIndicator(floor int)                                   {}
+func (d *recordingDriver) SetDoorOpenLamp(value bool)                                    { d.doorOpen = value }
+func (d *recordingDriver) GetFloor() int                                                 { return 1 }
+
+func TestDriver_JamAndDisconnect(t *testing.T) {
+	inner := &recordingDriver{}
+	d := NewDriver(inner)
+
+	d.Jam(true)
+	d.SetMotorDirection(elevio.MD_Up)
+	if inner.direction != elevio.MD_Stop {
+		t.Errorf("Expected a jammed motor not to move, was %v", inner.direction)
+	}
+	d.Jam(false)
+	if inner.direction != elevio.MD_Up {
+		t.Errorf("Expected the motor to move as commanded once released, was %v", inner.direction)
+	}
+
+	d.Disconnect(true)
+	d.SetMotorDirection(elevio.MD_Stop)
+	d.SetDoorOpenLamp(true)
+	if inner.direction != elevio.MD_Up || inner.doorOpen || d.GetFloor() != -1 {
+		t.Errorf("Expected outputs and floor sensor of a disconnected driver to be lost")
+	}
+	d.Disconnect(false)
+	if inner.direction != elevio.MD_Stop || d.GetFloor() != 1 {
+		t.Errorf("Expected the last command to apply once reconnected, was %v", inner.direction)
+	}
+}
+
+func TestNode_InjectsThroughAPIAndLifts(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	obstructions := make(chan bool, 2)
+	node := &Node{
+		Transport: NewTransport(transport.NewNetwork(transport.NetworkConfig{}).Node(0), clk, 1),
+		Driver:    NewDriver(&recordingDriver{}),
+		Clock:     clk,
+		Freeze:    func(d time.Duration) {},
+		Obstruct:  func(obstructed bool) { obstructions <- obstructed },
+	}
+	mux := http.NewServeMux()
+	Register(mux, node)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/chaos", strings.NewReader(`{"kind": "hold_obstruction", "duration": "10s"}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected the fault to be accepted, was %d %s", rec.Code, rec.Body)
+	}
+	if !<-obstructions {
+		t.Error("Expected the obstruction switch to turn on")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chaos", nil))
+	var faults []Fault
+	if err := json.NewDecoder(rec.Body).Decode(&faults); err != nil || len(faults) != 1 || faults[0].Duration != 10*time.Second {
+		t.Errorf("Expected the active fault, was %v %v", faults, err)
+	}
+
+	clk.Advance(10 * time.Second)
+	if <-obstructions {
+		t.Error("Expected the obstruction switch to turn off once lifted")
+	}
+	if faults := node.Faults(); len(faults) != 0 {
+		t.Errorf("Expected no active faults, was %v", faults)
+	}
+
+	for _, body := range []string{`{"kind": "melt"}`, `{"kind": "drop", "rate": 2}`, `{"kind": "drop", "rate": 0.5, "port": "dashboard"}`} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/chaos", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, was %d", body, rec.Code)
+		}
+	}
+}
+
+func TestNode_KillStopsTheCarBeforeExiting(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	inner := &recordingDriver{}
+	node := &Node{
+		Transport: NewTransport(transport.NewNetwork(transport.NetworkConfig{}).Node(0), clk, 1),
+		Driver:    NewDriver(inner),
+		Clock:     clk,
+		Freeze:    func(d time.Duration) {},
+	}
+	node.Driver.SetMotorDirection(elevio.MD_Up)
+	exited := false
+	node.Exit = func() {
+		exited = true
+		if inner.direction != elevio.MD_Stop || node.Driver.GetFloor() != -1 {
+			t.Error("Expected the car to be stopped and disconnected before exiting")
+		}
+	}
+
+	node.Inject(Fault{Kind: FK_Kill})
+	if !exited {
+		t.Error("Expected the killed node to exit")
+	}
+}
+
+func TestDriver_GatesFloorsWhileDisconnected(t *testing.T) {
+	d := NewDriver(&recordingDriver{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in, out := make(chan int), make(chan int, 4)
+	go d.GateFloors(ctx, in, out)
+
+	in <- 0
+	if floor := <-out; floor != 0 {
+		t.Errorf("Expected floor 0 to pass, was %d", floor)
+	}
+
+	d.Disconnect(true)
+	in <- 1
+	in <- 2
+	time.Sleep(10 * time.Millisecond) // lets the gate drop floor 2 as well
+	select {
+	case floor := <-out:
+		t.Errorf("Expected no floor to arrive while disconnected, was %d", floor)
+	default:
+	}
+
+	d.Disconnect(false)
+	select {
+	case floor := <-out:
+		if floor != 1 {
+			t.Errorf("Expected the floor the car stands at once reconnected, was %d", floor)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the floor the car stands at once reconnected")
+	}
+}
+
+func TestNode_LiftsNoFaultsOnceStopped(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	inner := &recordingDriver{}
+	node := &Node{
+		Transport: NewTransport(transport.NewNetwork(transport.NetworkConfig{}).Node(0), clk, 1),
+		Driver:    NewDriver(inner),
+		Clock:     clk,
+		Freeze:    func(d time.Duration) {},
+	}
+	node.Driver.SetMotorDirection(elevio.MD_Up)
+	if err := node.Inject(Fault{Kind: FK_JamMotor, Duration: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	node.Stop()
+	clk.Advance(time.Second)
+	if inner.direction != elevio.MD_Stop {
+		t.Errorf("Expected the jam not to be lifted once the node stopped, was %v", inner.direction)
+	}
+	if err := node.Inject(Fault{Kind: FK_JamMotor}); err == nil {
+		t.Error("Expected faults to be rejected once the node stopped")
+	}
+}
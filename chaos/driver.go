@@ -0,0 +1,128 @@
+package chaos
+
+import (
+	"context"
+	"elevator/elevio"
+	"sync"
+)
+
+// Driver wraps the driver of an elevator to disconnect it or jam its motor. The floors polled
+// from the elevator must pass `GateFloors`.
+type Driver struct {
+	inner elevio.Driver
+
+	mtx          sync.Mutex
+	direction    elevio.MotorDirection // last direction commanded by the controller
+	disconnected bool
+	jammed       bool
+	reconnected  chan struct{} // signalled when reconnected, so the floor sensor is read again
+}
+
+func NewDriver(inner elevio.Driver) *Driver {
+	return &Driver{inner: inner, reconnected: make(chan struct{}, 1)}
+}
+
+// Disconnect loses all outputs to the elevator and reads the floor sensor as between floors,
+// until called with `false`. The motor keeps running as last commanded.
+func (d *Driver) Disconnect(disconnected bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.disconnected && !disconnected {
+		select {
+		case d.reconnected <- struct{}{}:
+		default:
+		}
+	}
+	d.disconnected = disconnected
+	d.apply()
+}
+
+// GateFloors forwards the floors polled from the elevator on `in` to `out` until `ctx` is done,
+// but none while disconnected since the floor sensor reads nothing then. Once reconnected, the
+// floor the car stands at is sent unless it was the last one sent.
+func (d *Driver) GateFloors(ctx context.Context, in <-chan int, out chan<- int) {
+	last := -1
+	for {
+		var floor int
+		select {
+		case <-ctx.Done():
+			return
+		case floor = <-in:
+			if d.isDisconnected() {
+				continue
+			}
+		case <-d.reconnected:
+			if floor = d.GetFloor(); floor == -1 || floor == last {
+				continue
+			}
+		}
+		select {
+		case out <- floor:
+			last = floor
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Jam stops the motor and keeps it from moving until called with `false`.
+func (d *Driver) Jam(jammed bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.jammed = jammed
+	d.apply()
+}
+
+// Drives the motor as commanded unless it is jammed. Must be called while holding `mtx`.
+func (d *Driver) apply() {
+	if d.disconnected {
+		return
+	}
+	if d.jammed {
+		d.inner.SetMotorDirection(elevio.MD_Stop)
+		return
+	}
+	d.inner.SetMotorDirection(d.direction)
+}
+
+func (d *Driver) SetMotorDirection(dir elevio.MotorDirection) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.direction = dir
+	d.apply()
+}
+
+func (d *Driver) SetButtonLamp(button elevio.ButtonType, floor int, value bool) {
+	if !d.isDisconnected() {
+		d.inner.SetButtonLamp(button, floor, value)
+	}
+}
+
+func (d *Driver) SetFloorIndicator(floor int) {
+	if !d.isDisconnected() {
+		d.inner.SetFloorIndicator(floor)
+	}
+}
+
+func (d *Driver) SetDoorOpenLamp(value bool) {
+	if !d.isDisconnected() {
+		d.inner.SetDoorOpenLamp(value)
+	}
+}
+
+func (d *Driver) GetFloor() int {
+	if d.isDisconnected() {
+		return -1
+	}
+	return d.inner.GetFloor()
+}
+
+func (d *Driver) isDisconnected() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return d.disconnected
+}
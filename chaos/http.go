@@ -0,0 +1,34 @@
+package chaos
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Register adds `POST /api/chaos`, injecting the fault in the body into `node`, and
+// `GET /api/chaos`, listing the faults not lifted yet, to `mux`.
+func Register(mux *http.ServeMux, node *Node) {
+	mux.HandleFunc("POST /api/chaos", func(w http.ResponseWriter, r *http.Request) {
+		var f Fault
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		// The fault is injected now into this node, whatever the timeline fields say
+		f.At, f.Node = 0, 0
+		if err := node.Inject(f); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("GET /api/chaos", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, node.Faults())
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,133 @@
+package chaos
+
+import (
+	"elevator/clock"
+	"elevator/transport"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Impairment drops datagrams on a port with probability `DropRate`, in both directions, and
+// delays the datagrams sent by `Delay`.
+type Impairment struct {
+	DropRate float64
+	Delay    time.Duration
+}
+
+// Transport wraps the transport of a node to impair single ports or cut the node off entirely.
+type Transport struct {
+	inner transport.Transport
+	clock clock.Clock
+
+	mtx          sync.Mutex
+	rng          *rand.Rand
+	impairments  map[string]Impairment
+	disconnected bool
+}
+
+// NewTransport wraps `inner`. Delays are timed by `clk` and drops are drawn from a generator
+// seeded with `seed`.
+func NewTransport(inner transport.Transport, clk clock.Clock, seed int64) *Transport {
+	return &Transport{
+		inner:       inner,
+		clock:       clk,
+		rng:         rand.New(rand.NewSource(seed)),
+		impairments: make(map[string]Impairment),
+	}
+}
+
+// Impair replaces the impairment of `port`. The zero Impairment heals the port.
+func (t *Transport) Impair(port string, imp Impairment) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if imp == (Impairment{}) {
+		delete(t.impairments, port)
+		return
+	}
+	t.impairments[port] = imp
+}
+
+// Disconnect cuts the node off the network: writes fail and nothing is received. Reconnects if
+// `disconnected` is false.
+func (t *Transport) Disconnect(disconnected bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.disconnected = disconnected
+}
+
+// Decides the fate of a datagram on `port`. Returns whether it is dropped and its delay.
+func (t *Transport) impair(port string) (bool, time.Duration) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.disconnected {
+		return true, 0
+	}
+	imp := t.impairments[port]
+	return imp.DropRate > 0 && t.rng.Float64() < imp.DropRate, imp.Delay
+}
+
+func (t *Transport) Dial(port string) (io.WriteCloser, error) {
+	conn, err := t.inner.Dial(port)
+	if err != nil {
+		return nil, err
+	}
+	return &sender{t, port, conn}, nil
+}
+
+func (t *Transport) Listen(port string) (io.ReadCloser, error) {
+	conn, err := t.inner.Listen(port)
+	if err != nil {
+		return nil, err
+	}
+	return &receiver{t, port, conn}, nil
+}
+
+type sender struct {
+	transport *Transport
+	port      string
+	io.WriteCloser
+}
+
+func (s *sender) Write(msg []byte) (int, error) {
+	t := s.transport
+	t.mtx.Lock()
+	disconnected := t.disconnected
+	t.mtx.Unlock()
+	if disconnected {
+		return 0, transport.ErrDisconnected
+	}
+
+	drop, delay := t.impair(s.port)
+	if drop {
+		return len(msg), nil
+	}
+	if delay > 0 {
+		datagram := append([]byte(nil), msg...)
+		t.clock.AfterFunc(delay, func() { s.WriteCloser.Write(datagram) })
+		return len(msg), nil
+	}
+	return s.WriteCloser.Write(msg)
+}
+
+type receiver struct {
+	transport *Transport
+	port      string
+	io.ReadCloser
+}
+
+func (r *receiver) Read(buf []byte) (int, error) {
+	for {
+		n, err := r.ReadCloser.Read(buf)
+		if err != nil {
+			return n, err
+		}
+		if drop, _ := r.transport.impair(r.port); !drop {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time of all subsystems, so they can run on virtual time in simulations.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker delivers ticks on `C()` like a `time.Ticker`.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer is a pending call of `AfterFunc`.
+type Timer interface {
+	Stop() bool
+}
+
+// SleepContext sleeps for `d` on `clk` unless `ctx` is done before. Reports whether it slept
+// for the full duration.
+func SleepContext(ctx context.Context, clk Clock, d time.Duration) bool {
+	ticker := clk.NewTicker(d)
+	defer ticker.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-ticker.C():
+		return true
+	}
+}
+
+// Real is the wall clock.
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (Real) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (Real) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,185 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a clock which only advances when `Advance` or `Step` is called. Timers and tickers due
+// within an advance fire in the order of their deadlines, at their deadline.
+type Fake struct {
+	mtx     sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	seq     int
+}
+
+// waiter is a sleep, ticker or timer waiting for the fake clock to reach `at`.
+type waiter struct {
+	at     time.Time
+	seq    int           // orders waiters with equal deadlines by creation
+	period time.Duration // of tickers, zero otherwise
+	ch     chan time.Time
+	f      func()
+}
+
+// NewFake creates a fake clock starting at `start`.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+func (c *Fake) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.now
+}
+
+func (c *Fake) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Sleep blocks until the clock was advanced by `d`.
+func (c *Fake) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	w := &waiter{ch: make(chan time.Time, 1)}
+	c.add(w, d)
+	<-w.ch
+}
+
+func (c *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	w := &waiter{period: d, ch: make(chan time.Time, 1)}
+	c.add(w, d)
+	return &fakeTicker{c, w}
+}
+
+// AfterFunc calls `f` once the clock was advanced by `d`. Unlike `time.AfterFunc`, `f` runs in the
+// goroutine advancing the clock before the advance goes on, so it must neither block nor wait
+// for the clock.
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	w := &waiter{f: f}
+	c.add(w, d)
+	return &fakeTimer{c, w}
+}
+
+// Advance moves the clock forward by `d` and fires everything due on the way, including timers
+// set by the callbacks of timers fired.
+func (c *Fake) Advance(d time.Duration) {
+	target := c.Now().Add(d)
+	for c.Step(target) {
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if target.After(c.now) {
+		c.now = target
+	}
+}
+
+// Step moves the clock to the deadline of the next sleep, ticker or timer and fires it, unless it
+// is due after `until`. Reports whether it fired one.
+func (c *Fake) Step(until time.Time) bool {
+	c.mtx.Lock()
+	if len(c.waiters) == 0 || c.waiters[0].at.After(until) {
+		c.mtx.Unlock()
+		return false
+	}
+	w := c.waiters[0]
+	c.waiters = c.waiters[1:]
+	if w.at.After(c.now) {
+		c.now = w.at
+	}
+
+	switch {
+	case w.f != nil:
+		c.mtx.Unlock()
+		w.f()
+		return true
+	case w.period > 0:
+		// Like time.Ticker, ticks are dropped for slow receivers
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+		w.at = w.at.Add(w.period)
+		c.insert(w)
+	default:
+		w.ch <- c.now
+	}
+	c.mtx.Unlock()
+	return true
+}
+
+// NextDeadline returns when the next sleep, ticker or timer is due. Returns false if nothing is waiting.
+func (c *Fake) NextDeadline() (time.Time, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if len(c.waiters) == 0 {
+		return time.Time{}, false
+	}
+	return c.waiters[0].at, true
+}
+
+func (c *Fake) add(w *waiter, d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	w.at = c.now.Add(d)
+	w.seq = c.seq
+	c.seq++
+	c.insert(w)
+}
+
+// Inserts `w` keeping the waiters sorted by deadline. Must be called while holding `mtx`.
+func (c *Fake) insert(w *waiter) {
+	i := sort.Search(len(c.waiters), func(i int) bool {
+		other := c.waiters[i]
+		return other.at.After(w.at) || (other.at.Equal(w.at) && other.seq > w.seq)
+	})
+	c.waiters = append(c.waiters, nil)
+	copy(c.waiters[i+1:], c.waiters[i:])
+	c.waiters[i] = w
+}
+
+// Removes `w` and reports whether it was still waiting.
+func (c *Fake) remove(w *waiter) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct {
+	clock *Fake
+	w     *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.remove(t.w)
+}
+
+type fakeTimer struct {
+	clock *Fake
+	w     *waiter
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.remove(t.w)
+}
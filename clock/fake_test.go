@@ -0,0 +1,95 @@
+package clock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFake_FiresTimersInOrderOfDeadlines(t *testing.T) {
+	c := NewFake(testStart)
+	fired := make(chan int, 3)
+	c.AfterFunc(3*time.Second, func() { fired <- 3 })
+	c.AfterFunc(1*time.Second, func() { fired <- 1 })
+	stopped := c.AfterFunc(2*time.Second, func() { fired <- 2 })
+
+	if !stopped.Stop() {
+		t.Error("Expected the pending timer to stop")
+	}
+	c.Advance(1 * time.Second)
+	if got := <-fired; got != 1 {
+		t.Errorf("Expected the 1s timer to fire first, got %d", got)
+	}
+	c.Advance(5 * time.Second)
+	if got := <-fired; got != 3 {
+		t.Errorf("Expected the 3s timer to fire, got %d", got)
+	}
+	if stopped.Stop() {
+		t.Error("Expected a stopped timer not to stop again")
+	}
+	if got := c.Since(testStart); got != 6*time.Second {
+		t.Errorf("Expected 6s to have passed, got %v", got)
+	}
+}
+
+func TestFake_TicksAtTheirDeadlines(t *testing.T) {
+	c := NewFake(testStart)
+	ticker := c.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var ticks []time.Duration
+	for range 3 {
+		c.Advance(100 * time.Millisecond)
+		ticks = append(ticks, (<-ticker.C()).Sub(testStart))
+	}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	if !reflect.DeepEqual(ticks, want) {
+		t.Errorf("Expected ticks at %v, got %v", want, ticks)
+	}
+}
+
+func TestFake_SleepReturnsOnceAdvanced(t *testing.T) {
+	c := NewFake(testStart)
+	woke := make(chan time.Time)
+	go func() {
+		c.Sleep(time.Minute)
+		woke <- c.Now()
+	}()
+
+	for {
+		if _, ok := c.NextDeadline(); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Advance(2 * time.Minute)
+	if got := <-woke; got.Sub(testStart) != 2*time.Minute {
+		t.Errorf("Expected to wake after the advance, woke at %v", got.Sub(testStart))
+	}
+}
+
+func TestFake_RunsCallbacksWithinAdvance(t *testing.T) {
+	c := NewFake(testStart)
+	var fired []time.Duration
+	record := func() { fired = append(fired, c.Since(testStart)) }
+	c.AfterFunc(2*time.Second, record)
+	c.AfterFunc(1*time.Second, func() {
+		record()
+		c.AfterFunc(500*time.Millisecond, record)
+	})
+	c.AfterFunc(3*time.Second, record)
+
+	c.Advance(2 * time.Second)
+	want := []time.Duration{1 * time.Second, 1500 * time.Millisecond, 2 * time.Second}
+	if !reflect.DeepEqual(fired, want) {
+		t.Errorf("Expected callbacks at %v once advanced, got %v", want, fired)
+	}
+	if c.Step(testStart.Add(2 * time.Second)) {
+		t.Error("Expected nothing due before the 3s timer")
+	}
+	if !c.Step(testStart.Add(time.Hour)) || len(fired) != 4 {
+		t.Errorf("Expected a step to fire the 3s timer, got %v", fired)
+	}
+}
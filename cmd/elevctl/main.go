@@ -0,0 +1,543 @@
+// Command elevctl debugs a running elevator cluster from any machine on the network.
+// It joins the cluster as a passive listener on the statesync and assigner ports.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"elevator/api"
+	asg "elevator/assigner"
+	"elevator/chaos"
+	"elevator/clock"
+	"elevator/controller"
+	"elevator/elevio"
+	"elevator/logging"
+	"elevator/report"
+	"elevator/sim"
+	sts "elevator/statesync"
+	"elevator/traffic"
+	"elevator/transport"
+)
+
+// elevctl identifies itself with this assigner ID when injecting hall calls.
+const elevctlID = 255
+
+const usage = `usage: elevctl <command> [flags]
+
+commands:
+  peers            list elevators heard within the listen duration
+  dump             print every decoded heartbeat and state
+  watch            print assignment traffic
+  hall             inject a hall call assigned to an elevator
+  out-of-service   take an elevator out of service via its API
+  replay           replay a journaled run against a fake elevator
+  traffic          generate passenger traffic, drive it into elevators or a simulation
+  report           report the dispatch performance from the journals of all elevators
+  chaos            inject a fault into an elevator started with -chaos via its API
+
+run "elevctl <command> -h" for the flags of a command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "peers":
+		err = peers(os.Args[2:])
+	case "dump":
+		err = dump(os.Args[2:])
+	case "watch":
+		err = watch(os.Args[2:])
+	case "hall":
+		err = hall(os.Args[2:])
+	case "out-of-service":
+		err = outOfService(os.Args[2:])
+	case "replay":
+		err = replay(os.Args[2:])
+	case "traffic":
+		err = trafficCmd(os.Args[2:])
+	case "report":
+		err = reportCmd(os.Args[2:])
+	case "chaos":
+		err = chaosCmd(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "elevctl:", err)
+		os.Exit(1)
+	}
+}
+
+// Calls `handle` with every datagram received on `port` until `duration` passed. Runs forever if
+// `duration` is zero.
+func listen(port string, duration time.Duration, handle func([]byte)) error {
+	conn, err := transport.UDP{}.Listen(port)
+	if err != nil {
+		return fmt.Errorf("listening on port %s (is an elevator running on this machine?): %w", port, err)
+	}
+	defer conn.Close()
+
+	if duration > 0 {
+		time.AfterFunc(duration, func() { conn.Close() })
+	}
+
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil
+		}
+		handle(buf[:n])
+	}
+}
+
+func peers(args []string) error {
+	flags := flag.NewFlagSet("peers", flag.ExitOnError)
+	duration := flags.Duration("t", 2*time.Second, "how long to listen")
+	flags.Parse(args)
+
+	type peer struct {
+		heartbeat sts.Message
+		state     *sts.Message
+		left      bool // announced leaving with its last incarnation heard
+		lastSeen  time.Time
+	}
+	heard := make(map[int]*peer)
+
+	err := listen(sts.BroadcastPort, *duration, func(b []byte) {
+		m, err := sts.DecodeMessage(b)
+		if err != nil {
+			return
+		}
+		p, exists := heard[m.ID]
+		if !exists || m.Incarnation > p.heartbeat.Incarnation {
+			p = &peer{heartbeat: m}
+			heard[m.ID] = p
+		}
+		p.lastSeen = time.Now()
+		if m.Leave {
+			p.left = true
+		} else if m.Heartbeat {
+			p.heartbeat = m
+		} else {
+			p.state = &m
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(heard))
+	for id := range heard {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tINCARNATION\tAVAILABILITY\tFLOOR\tDIRECTION\tLAST SEEN")
+	for _, id := range ids {
+		p := heard[id]
+		floor, direction := "?", "?"
+		if p.state != nil {
+			floor, direction = fmt.Sprint(p.state.Floor), api.DirectionName(p.state.Direction)
+		}
+		availability := p.heartbeat.Availability.String()
+		if p.left {
+			availability = "left"
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s ago\n", id, p.heartbeat.Incarnation, availability,
+			floor, direction, time.Since(p.lastSeen).Round(time.Millisecond))
+	}
+	return w.Flush()
+}
+
+func dump(args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	duration := flags.Duration("t", 0, "how long to listen (forever if 0)")
+	id := flags.Int("id", -1, "only print messages of this elevator")
+	heartbeats := flags.Bool("heartbeats", false, "also print heartbeats")
+	flags.Parse(args)
+
+	return listen(sts.BroadcastPort, *duration, func(b []byte) {
+		m, err := sts.DecodeMessage(b)
+		if err != nil {
+			fmt.Printf("%s malformed message of %d bytes\n", timestamp(), len(b))
+			return
+		}
+		if (*id >= 0 && m.ID != *id) || (m.Heartbeat && !*heartbeats) {
+			return
+		}
+		if m.Heartbeat {
+			fmt.Printf("%s heartbeat elevator=%d incarnation=%d nonce=%d availability=%v\n",
+				timestamp(), m.ID, m.Incarnation, m.Nonce, m.Availability)
+			return
+		}
+		if m.Leave {
+			fmt.Printf("%s leave elevator=%d incarnation=%d\n", timestamp(), m.ID, m.Incarnation)
+			return
+		}
+		fmt.Printf("%s state elevator=%d incarnation=%d nonce=%d floor=%d direction=%s behaviour=%v availability=%v door=%v obstructed=%v between=%v requests=%s\n",
+			timestamp(), m.ID, m.Incarnation, m.Nonce, m.Floor, api.DirectionName(m.Direction), m.Behaviour, m.Availability,
+			m.DoorOpen, m.Obstructed, m.BetweenFloors, requestsString(m.Requests))
+	})
+}
+
+func watch(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	duration := flags.Duration("t", 0, "how long to listen (forever if 0)")
+	flags.Parse(args)
+
+	return listen(asg.BroadcastPort, *duration, func(b []byte) {
+		m, err := asg.DecodeMessage(b)
+		if err != nil {
+			fmt.Printf("%s malformed assignment of %d bytes\n", timestamp(), len(b))
+			return
+		}
+		fmt.Printf("%s assignment %d -> %d floor=%d button=%s nonce=%d\n",
+			timestamp(), m.AssignerID, m.AssigneeID, m.Button.Floor, buttonName(m.Button.Button), m.Nonce)
+	})
+}
+
+func hall(args []string) error {
+	flags := flag.NewFlagSet("hall", flag.ExitOnError)
+	to := flags.Int("to", -1, "ID of the elevator which should serve the call")
+	floor := flags.Int("floor", -1, "floor of the hall call")
+	floors := flags.Int("floors", 4, "number of floors of the building")
+	button := flags.String("button", "up", "direction of the hall call: up or down")
+	flags.Parse(args)
+
+	if *to < 0 || *floor < 0 {
+		return fmt.Errorf("-to and -floor are required")
+	}
+	if *floor >= *floors {
+		return fmt.Errorf("-floor must be below the %d floors of the building", *floors)
+	}
+	buttons := map[string]elevio.ButtonType{"up": elevio.BT_HallUp, "down": elevio.BT_HallDown}
+	btn, exists := buttons[*button]
+	if !exists {
+		return fmt.Errorf("unknown button %q", *button)
+	}
+
+	conn, err := transport.UDP{}.Dial(asg.BroadcastPort)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Assignees deduplicate by increasing nonce per assigner, so every run must use a larger one.
+	msg := asg.EncodeMessage(asg.Message{
+		AssigneeID: *to,
+		AssignerID: elevctlID,
+		Button:     elevio.ButtonEvent{Floor: *floor, Button: btn},
+		Nonce:      int(time.Now().UnixMilli() / 10 % (1 << 31)),
+	})
+	for range 10 {
+		if _, err := conn.Write(msg); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("assigned hall %s at floor %d to elevator %d\n", *button, *floor, *to)
+	return nil
+}
+
+func outOfService(args []string) error {
+	flags := flag.NewFlagSet("out-of-service", flag.ExitOnError)
+	addr := flags.String("api", "", "API address of the elevator, e.g. 10.100.23.12:8080")
+	disable := flags.Bool("disable", false, "put the elevator back into service instead")
+	flags.Parse(args)
+
+	if *addr == "" {
+		return fmt.Errorf("-api is required")
+	}
+	body, _ := json.Marshal(map[string]bool{"enabled": !*disable})
+	resp, err := http.Post("http://"+*addr+"/api/out-of-service", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	fmt.Printf("out of service: %v\n", !*disable)
+	return nil
+}
+
+func replay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	run := flags.Int("run", -1, "index of the run to replay, negative counts from the last run")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: elevctl replay [-run n] <journal>")
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	runs, err := controller.ReadJournal(file)
+	if err != nil {
+		return err
+	}
+	index := *run
+	if index < 0 {
+		index += len(runs)
+	}
+	if index < 0 || index >= len(runs) {
+		return fmt.Errorf("journal has %d runs", len(runs))
+	}
+	return controller.Replay(runs[index], os.Stdout)
+}
+
+// Time the simulation keeps running after the last call of a scenario.
+const trafficDrainTime = 2 * time.Minute
+
+func trafficCmd(args []string) error {
+	flags := flag.NewFlagSet("traffic", flag.ExitOnError)
+	scenario := flags.String("scenario", "", "JSONL scenario file to play instead of generating traffic")
+	profile := flags.String("profile", traffic.Random.Name, "profile of generated traffic: "+profileNames())
+	floors := flags.Int("floors", 4, "number of floors of the building")
+	elevators := flags.Int("elevators", 3, "number of elevators, given by -api if set")
+	duration := flags.Duration("duration", 5*time.Minute, "time within which generated passengers arrive")
+	rate := flags.Float64("rate", 6, "mean number of generated passengers per minute")
+	seed := flags.Int64("seed", 1, "seed of the generated traffic and the simulated network")
+	out := flags.String("out", "", "write the scenario to this file (- for stdout) instead of playing it")
+	apiAddrs := flags.String("api", "", "comma separated API addresses of elevators 0, 1, ... to play the scenario on")
+	simulate := flags.Bool("sim", false, "play the scenario in a simulation and check the service guarantees")
+	format := flags.String("report", "text", "format of the performance report of a simulation: text, json or csv")
+	timelinePath := flags.String("chaos", "", "JSONL timeline of faults injected into the simulation")
+	flags.Parse(args)
+
+	var addrs []string
+	if *apiAddrs != "" {
+		addrs = strings.Split(*apiAddrs, ",")
+		*elevators = len(addrs)
+	}
+
+	var calls []traffic.Call
+	if *scenario != "" {
+		file, err := os.Open(*scenario)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if calls, err = traffic.Read(file); err != nil {
+			return fmt.Errorf("%s: %w", *scenario, err)
+		}
+	} else {
+		p, exists := traffic.ProfileByName(*profile)
+		if !exists {
+			return fmt.Errorf("unknown profile %q, use one of %s", *profile, profileNames())
+		}
+		calls = p.Generate(traffic.Config{Floors: *floors, Elevators: *elevators, Duration: *duration, Rate: *rate, Seed: *seed})
+	}
+	if err := traffic.Validate(calls, *floors, *elevators); err != nil {
+		return err
+	}
+
+	switch {
+	case *out == "-":
+		return traffic.Write(os.Stdout, calls)
+	case *out != "":
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return traffic.Write(file, calls)
+
+	case *simulate:
+		// The controllers log in wall clock time, which means nothing in a simulation
+		logging.SetLevel("", slog.LevelWarn)
+		s := sim.New(sim.Config{Elevators: *elevators, Floors: *floors, Network: transport.NetworkConfig{Seed: *seed}})
+		defer s.Close()
+		s.Press(calls...)
+		if *timelinePath != "" {
+			file, err := os.Open(*timelinePath)
+			if err != nil {
+				return err
+			}
+			timeline, err := chaos.ReadTimeline(file)
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", *timelinePath, err)
+			}
+			if err := s.Inject(timeline); err != nil {
+				return err
+			}
+		}
+		end := trafficDrainTime
+		if len(calls) > 0 {
+			end += calls[len(calls)-1].At
+		}
+		s.Run(end)
+
+		if err := writeReport(os.Stdout, report.New(s.Events()), *format); err != nil {
+			return err
+		}
+		errs := s.Check()
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		fmt.Fprintf(os.Stderr, "%d passengers in %v of simulated time, %d violations\n", len(calls), end, len(errs))
+		if len(errs) > 0 {
+			return fmt.Errorf("service guarantees violated")
+		}
+		return nil
+
+	case len(addrs) > 0:
+		return traffic.Play(calls, clock.Real{}, func(c traffic.Call) error {
+			fmt.Printf("%s %s\n", timestamp(), c)
+			return traffic.APIPresser(http.DefaultClient, addrs)(c)
+		})
+	}
+	return fmt.Errorf("one of -out, -sim or -api is required")
+}
+
+func chaosCmd(args []string) error {
+	flags := flag.NewFlagSet("chaos", flag.ExitOnError)
+	addr := flags.String("api", "", "API address of the elevator, e.g. 10.100.23.12:8080")
+	kind := flags.String("kind", "", "fault: kill, freeze, drop, delay, disconnect_driver, jam_motor or hold_obstruction")
+	duration := flags.Duration("duration", 0, "lift the fault after this time (0 keeps it until the elevator restarts)")
+	port := flags.String("port", "", "statesync or assigner for drop and delay, both if empty")
+	rate := flags.Float64("rate", 0, "probability of dropping a datagram")
+	delay := flags.Duration("delay", 0, "delay of sent datagrams")
+	list := flags.Bool("list", false, "list the active faults instead")
+	flags.Parse(args)
+
+	if *addr == "" {
+		return fmt.Errorf("-api is required")
+	}
+	if *list {
+		resp, err := http.Get("http://" + *addr + "/api/chaos")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var faults []chaos.Fault
+		if err := json.NewDecoder(resp.Body).Decode(&faults); err != nil {
+			return fmt.Errorf("%s: %w (was the elevator started with -chaos?)", resp.Status, err)
+		}
+		for _, f := range faults {
+			fmt.Println(f)
+		}
+		return nil
+	}
+
+	body, _ := json.Marshal(chaos.Fault{Kind: chaos.Kind(*kind), Duration: *duration, Port: *port, Rate: *rate, Delay: *delay})
+	resp, err := http.Post("http://"+*addr+"/api/chaos", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	fmt.Printf("injected %s\n", *kind)
+	return nil
+}
+
+func reportCmd(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	format := flags.String("format", "text", "format of the report: text, json or csv")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: elevctl report [-format text|json|csv] <journal of each elevator>...")
+	}
+	var streams [][]controller.Event
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		runs, err := controller.ReadJournal(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		var events []controller.Event
+		for _, run := range runs {
+			events = append(events, run...)
+		}
+		streams = append(streams, events)
+	}
+	return writeReport(os.Stdout, report.New(streams), *format)
+}
+
+func writeReport(w io.Writer, r report.Report, format string) error {
+	switch format {
+	case "text":
+		return r.WriteText(w)
+	case "csv":
+		return r.WriteCSV(w)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+func profileNames() string {
+	names := make([]string, len(traffic.Profiles))
+	for i, p := range traffic.Profiles {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func timestamp() string {
+	return time.Now().Format("15:04:05.000")
+}
+
+func buttonName(b elevio.ButtonType) string {
+	switch b {
+	case elevio.BT_HallUp:
+		return "up"
+	case elevio.BT_HallDown:
+		return "down"
+	}
+	return "cab"
+}
+
+// Formats requests per floor as `<up><down><cab>`, e.g. `U-C` for a hall up and a cab call.
+func requestsString(requests [][3]bool) string {
+	var buf bytes.Buffer
+	for floor, r := range requests {
+		if floor > 0 {
+			buf.WriteByte(' ')
+		}
+		for btn, symbol := range "UDC" {
+			if r[btn] {
+				buf.WriteRune(symbol)
+			} else {
+				buf.WriteByte('-')
+			}
+		}
+	}
+	return buf.String()
+}
@@ -2,15 +2,40 @@ package controller
 
 import (
 	"elevator/elevio"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"os"
 )
 
-const hallCallStatePath = ".cabcall_cache"
+// DefaultCabCallCache is the path of the cab call cache unless configured otherwise, followed by
+// the elevator ID so elevators sharing a directory keep separate caches.
+const DefaultCabCallCache = ".cabcall_cache"
 
-func restoreRequests(numFloors int) [][3]bool {
-	file, err := os.Open(hallCallStatePath)
+// Returns the default path of the cab call cache of elevator `id`.
+func defaultCabCallCache(id int) string {
+	return fmt.Sprintf("%s_%d", DefaultCabCallCache, id)
+}
+
+// Moves the cab call cache at `legacy`, the default path of older versions, to `path` unless
+// there is a cache at `path` already, so the cab calls survive an upgrade. The legacy cache is
+// moved rather than copied, as only one elevator may take over its cab calls.
+func migrateCabCallCache(legacy, path string) {
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	err := os.Rename(legacy, path)
+	switch {
+	case err == nil:
+		_log.Info("moved cab call cache of an older version", "from", legacy, "to", path)
+	case !errors.Is(err, fs.ErrNotExist):
+		_log.Error("moving cab call cache of an older version failed", "from", legacy, "to", path, "err", err)
+	}
+}
+
+func restoreRequests(path string, numFloors int) [][3]bool {
+	file, err := os.Open(path)
 	if err != nil {
 		return make([][3]bool, numFloors)
 	}
@@ -19,7 +44,7 @@ func restoreRequests(numFloors int) [][3]bool {
 	content, _ := io.ReadAll(file)
 
 	if len(content) != numFloors {
-		log.Printf("Invalid state of `%s`: Not engough floors\n", hallCallStatePath)
+		_log.Warn("invalid cab call cache: not enough floors", "path", path)
 		return make([][3]bool, numFloors)
 	}
 
@@ -33,10 +58,10 @@ func restoreRequests(numFloors int) [][3]bool {
 	return requests
 }
 
-func flushRequests(requests [][3]bool) {
-	file, err := os.OpenFile(hallCallStatePath, os.O_CREATE|os.O_WRONLY, 0644)
+func flushRequests(path string, requests [][3]bool) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Printf("Error writing to `%s`\n", hallCallStatePath)
+		_log.Error("writing cab call cache failed", "path", path, "err", err)
 		return
 	}
 	defer file.Close()
@@ -49,3 +74,10 @@ func flushRequests(requests [][3]bool) {
 		}
 	}
 }
+
+// Writes the cab calls of the elevator to the cab call cache unless it is not persisted, e.g. in a replay.
+func (e *elevator) flushRequests() {
+	if e.cabCallCache != "" {
+		flushRequests(e.cabCallCache, e.requests)
+	}
+}
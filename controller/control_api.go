@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"elevator/api"
+	asg "elevator/assigner"
+	"elevator/elevio"
+	sts "elevator/statesync"
+)
+
+// controlAPI implements `api.Controller` by passing requests into the main event loop,
+// so the elevator is only ever accessed from the loop. Requests are dropped once the loop stopped.
+type controlAPI struct {
+	stopped            <-chan struct{}
+	statusRequests     chan chan api.ElevatorStatus
+	buttonEvents       chan elevio.ButtonEvent
+	outOfServiceEvents chan bool
+	faults             *faultLog
+	sync               *sts.Sync
+	assigner           *asg.Assigner
+}
+
+func (c *controlAPI) Status() api.ElevatorStatus {
+	reply := make(chan api.ElevatorStatus)
+	select {
+	case c.statusRequests <- reply:
+		return <-reply
+	case <-c.stopped:
+		return api.ElevatorStatus{}
+	}
+}
+
+func (c *controlAPI) Faults() []api.Fault {
+	return c.faults.recent()
+}
+
+func (c *controlAPI) InjectCall(b elevio.ButtonEvent) {
+	select {
+	case c.buttonEvents <- b:
+	case <-c.stopped:
+	}
+}
+
+func (c *controlAPI) SetOutOfService(outOfService bool) {
+	select {
+	case c.outOfServiceEvents <- outOfService:
+	case <-c.stopped:
+	}
+}
+
+func (c *controlAPI) Peers() []api.PeerStatus {
+	return api.PeerStatuses(c.sync)
+}
+
+func (c *controlAPI) AliveElevatorIDs() []int {
+	return c.sync.GetAliveElevatorIDs()
+}
+
+func (c *controlAPI) PendingAssignments() []asg.Assignment {
+	return c.assigner.GetPendingAssignments()
+}
+
+func (s stateFSM) String() string {
+	switch s {
+	case ST_Idle:
+		return "idle"
+	case ST_Moving:
+		return "moving"
+	case ST_DoorOpen:
+		return "door_open"
+	}
+	return "unknown"
+}
+
+func (e *elevator) status() api.ElevatorStatus {
+	return api.ElevatorStatus{
+		ID:             e.id,
+		Behaviour:      e.state.String(),
+		Floor:          e.floor,
+		Direction:      api.DirectionName(e.direction),
+		DoorObstructed: e.doorObstructed,
+		Availability:   e.sync.GetAvailability(e.id).String(),
+		OutOfService:   e.outOfService,
+		Offline:        e.sync.IsOffline(),
+		Requests:       e.copyRequests(),
+	}
+}
@@ -1,12 +1,20 @@
 package controller
 
 import (
-	"log"
+	"context"
+	"io"
+	"sync"
 	"time"
 
+	"elevator/api"
 	asg "elevator/assigner"
+	"elevator/chaos"
+	"elevator/clock"
 	"elevator/elevio"
+	"elevator/logging"
 	sts "elevator/statesync"
+	"elevator/transport"
+	"elevator/types"
 )
 
 const (
@@ -14,169 +22,465 @@ const (
 	floorPollInterval = 20 * time.Millisecond
 )
 
-var _elevatorID int
+var _log = logging.For("controller")
 
-func StartControlLoop(elevatorID int, driverAddr string, numFloors int) {
-	_elevatorID = elevatorID
+// Inputs are the events read from the elevator hardware.
+type Inputs struct {
+	Buttons     chan elevio.ButtonEvent
+	Floors      chan int
+	Obstruction chan bool
+	Stop        chan bool
+}
 
-	buttonEvents := make(chan elevio.ButtonEvent)
-	floorEvents := make(chan int)
-	obstructionEvents := make(chan bool)
-	stopEvents := make(chan bool)
-	assignmentEvents := make(chan elevio.ButtonEvent)
-	errorEvents := make(chan string)
+// Controller runs one elevator together with its state sync and assigner.
+type Controller struct {
+	elevator *elevator
+	sync     *sts.Sync
+	assigner *asg.Assigner
+	inputs   Inputs
+
+	assignmentEvents   chan elevio.ButtonEvent
+	unassignmentEvents chan elevio.ButtonEvent
+	memberEvents       chan sts.MemberEvent
+	statusRequests     chan chan api.ElevatorStatus
+	outOfServiceEvents chan bool
+	freezeEvents       chan time.Duration
+	stopped            chan struct{} // closed once the main event loop returned
+}
 
-	elevator := initializeElevator(elevatorID, driverAddr, numFloors)
+// New creates the controller of elevator `id` driving `driver`, which must stand at a floor.
+// Hardware events are read from `inputs`, messages of other elevators are exchanged over `tr` and
+// all timing is done by `clk`.
+func New(id int, numFloors int, driver elevio.Driver, inputs Inputs, tr transport.Transport, clk clock.Clock) *Controller {
+	c := &Controller{
+		elevator:           newElevator(id, driver, clk, driver.GetFloor(), make([][3]bool, numFloors)),
+		inputs:             inputs,
+		assignmentEvents:   make(chan elevio.ButtonEvent),
+		unassignmentEvents: make(chan elevio.ButtonEvent),
+		memberEvents:       make(chan sts.MemberEvent),
+		statusRequests:     make(chan chan api.ElevatorStatus),
+		outOfServiceEvents: make(chan bool),
+		freezeEvents:       make(chan time.Duration),
+		stopped:            make(chan struct{}),
+	}
+	c.sync = sts.New(c.elevator, tr, clk, inputs.Buttons, c.unassignmentEvents, c.memberEvents)
+	c.assigner = asg.New(id, numFloors, tr, c.sync, clk, c.assignmentEvents)
+	c.elevator.sync = c.sync
+	c.elevator.assigner = c.assigner
+	c.elevator.motor.supervise(DefaultTravelTime, c.elevator.reportMotorFault)
+	return c
+}
 
-	asg.Init(_elevatorID, assignmentEvents)
-	sts.Init(elevator, buttonEvents, errorEvents)
+// PersistCabCalls restores the cab calls from the cab call cache at `path` and writes them there
+// whenever they change, so they survive a restart. Must be called before `Run`.
+func (c *Controller) PersistCabCalls(path string) {
+	c.elevator.requests = restoreRequests(path, len(c.elevator.requests))
+	c.elevator.cabCallCache = path
+}
 
-	// Start polling for events
-	go setButtonLights(elevator.requests)
+// SetCapacity advertises that the car takes `passengers`. Must be called before `Run`.
+func (c *Controller) SetCapacity(passengers int) {
+	c.elevator.capacity = passengers
+}
 
-	go elevio.PollButtons(buttonEvents)
-	go elevio.PollFloorSensor(floorEvents)
-	go elevio.PollObstructionSwitch(obstructionEvents)
-	go elevio.PollStopButton(stopEvents)
-	go asg.ReceiveAssignments()
-	go elevator.processElevatorErrors(errorEvents)
+// SuperviseMotor declares the motor lost whenever the car takes clearly longer than `travelTime`
+// to reach the next floor. Must be called before `Run`.
+func (c *Controller) SuperviseMotor(travelTime time.Duration) {
+	c.elevator.motor.supervise(travelTime, c.elevator.reportMotorFault)
+}
 
-	// Main event loop
+// API returns the part of the controller exposed over HTTP.
+func (c *Controller) API() api.Controller {
+	return &controlAPI{c.stopped, c.statusRequests, c.inputs.Buttons, c.outOfServiceEvents, &c.elevator.faults, c.sync, c.assigner}
+}
+
+// Freeze stalls the main event loop for `d`, as if the process hung. Returns once the loop stalled
+// or if it stopped.
+func (c *Controller) Freeze(d time.Duration) {
+	select {
+	case c.freezeEvents <- d:
+	case <-c.stopped:
+	}
+}
+
+// ChaosNode returns the fault injection target of the controller, which must have been created
+// with the wrapped transport `tr` and driver `driver`. `exit` is called on kill if not nil.
+func (c *Controller) ChaosNode(tr *chaos.Transport, driver *chaos.Driver, exit func()) *chaos.Node {
+	return &chaos.Node{
+		Transport: tr,
+		Driver:    driver,
+		Clock:     c.elevator.clock,
+		Freeze:    c.Freeze,
+		Obstruct: func(obstructed bool) {
+			select {
+			case c.inputs.Obstruction <- obstructed:
+			case <-c.stopped:
+			}
+		},
+		Exit: exit,
+	}
+}
+
+// JournalTo appends every event consumed by the main event loop and every output of the elevator
+// to `w`. Must be called before `Run`.
+func (c *Controller) JournalTo(w io.Writer, name string) {
+	c.elevator.journal = newJournal(w, name)
+}
+
+// Run starts serving the elevator and runs the main event loop until `ctx` is done. The elevator
+// then leaves in order: the car stops, its cab calls are written to the cab call cache and the
+// state sync announces leaving, so peers take over its hall calls at once. Returns once the state
+// sync and the assigner closed their connections.
+func (c *Controller) Run(ctx context.Context) {
+	e := c.elevator
+	if e.journal != nil {
+		e.driver = &journaledDriver{Driver: e.driver, journal: e.journal, clock: e.clock}
+	}
+	floor := e.floor
+	e.journal.record(Event{Time: e.clock.Now(), Kind: EV_Start, ElevatorID: e.id, Floor: &floor, Requests: e.copyRequests()})
+	e.start()
+
+	// Everything but the main event loop keeps running until the departure was announced
+	background, stopBackground := context.WithCancel(context.WithoutCancel(ctx))
+	var wg sync.WaitGroup
+	for _, run := range []func(context.Context){
+		c.assigner.ReceiveAssignments,
+		c.assigner.TrackAssignments,
+		func(ctx context.Context) { e.setButtonLights(ctx, c.sync.Subscribe()) },
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(background)
+		}()
+	}
+	c.sync.Start(background)
+
+	c.loop(ctx)
+	close(c.stopped)
+
+	e.halt()
+	stopBackground()
+	c.sync.Wait()
+	wg.Wait()
+	_log.Info("elevator stopped")
+}
+
+// Main event loop, runs until `ctx` is done.
+func (c *Controller) loop(ctx context.Context) {
+	e := c.elevator
 	for {
 		select {
-		case button := <-buttonEvents:
-			elevator.handleButtonPress(button)
+		case <-ctx.Done():
+			return
+
+		case button := <-c.inputs.Buttons:
+			assigneeID := e.dispatch(button)
+			e.process(ctx, Event{Kind: EV_Button, Button: &button, AssigneeID: &assigneeID})
+
+		case assignment := <-c.assignmentEvents:
+			e.process(ctx, Event{Kind: EV_Assignment, Button: &assignment})
+
+		case unassignment := <-c.unassignmentEvents:
+			e.process(ctx, Event{Kind: EV_Unassignment, Button: &unassignment})
+
+		case floor := <-c.inputs.Floors:
+			e.process(ctx, Event{Kind: EV_Floor, Floor: &floor})
+
+		case obstruction := <-c.inputs.Obstruction:
+			e.process(ctx, Event{Kind: EV_Obstruction, Value: obstruction})
 
-		case assignment := <-assignmentEvents:
-			elevator.handleAssignment(assignment)
+		case stop := <-c.inputs.Stop:
+			e.process(ctx, Event{Kind: EV_Stop, Value: stop})
 
-		case floor := <-floorEvents:
-			elevator.handleFloorChange(floor, errorEvents)
+		case member := <-c.memberEvents:
+			e.process(ctx, Event{Kind: EV_Member, Member: &member})
 
-		case obstruction := <-obstructionEvents:
-			elevator.handleDoorObstruction(obstruction, errorEvents)
+		case <-e.timeouts.ready:
+			e.handleTimeouts(ctx)
 
-		case stop := <-stopEvents:
-			elevator.handleStopButton(stop)
+		case reply := <-c.statusRequests:
+			reply <- e.status()
+
+		case outOfService := <-c.outOfServiceEvents:
+			e.process(ctx, Event{Kind: EV_OutOfService, Value: outOfService})
+
+		case d := <-c.freezeEvents:
+			_log.Warn("main loop frozen", "duration", d)
+			clock.SleepContext(ctx, e.clock, d) // a frozen elevator still stops
 		}
 	}
 }
 
-func initializeElevator(id int, driverAddr string, numFloors int) *elevator {
-	elevio.Init(driverAddr, numFloors)
+// Stops the car where it is, writes the cab calls to the cab call cache and takes the elevator
+// out of service for good, which is the state it broadcasts last before leaving.
+func (e *elevator) halt() {
+	_log.Info("shutting down, handing over hall calls")
+	e.halted = true
+	e.driver.SetMotorDirection(elevio.MD_Stop)
+	e.flushRequests()
+	e.setAvailability(types.AV_OutOfService)
+}
 
-	moveToNearestFloor()
+func newElevator(id int, driver elevio.Driver, clk clock.Clock, floor int, requests [][3]bool) *elevator {
+	motor := newMotorSupervisor(clk, floor)
+	return &elevator{
+		id:              id,
+		driver:          &supervisedDriver{Driver: driver, motor: motor},
+		floorSensor:     driver.GetFloor,
+		motor:           motor,
+		clock:           clk,
+		metrics:         newElevatorMetrics(id),
+		state:           ST_Idle,
+		floor:           floor,
+		direction:       elevio.MD_Stop,
+		requests:        requests,
+		requestsChanged: make(chan struct{}, 1),
+		timeouts:        newTimeoutQueue(),
+		requestTimes:    make([][3]time.Time, len(requests)),
+		doorObstructed:  false,
+	}
+}
+
+// Starts serving the requests the elevator was created with.
+func (e *elevator) start() {
+	e.determineNextDirection(elevio.MD_Stop)
+	e.driver.SetMotorDirection(e.direction)
 
-	elevator := &elevator{
-		id:             id,
-		state:          ST_Idle,
-		floor:          elevio.GetFloor(),
-		direction:      elevio.MD_Stop,
-		requests:       restoreRequests(numFloors),
-		doorObstructed: false,
+	if e.requests[e.floor][elevio.BT_Cab] {
+		e.openAndCloseDoor()
 	}
+	e.publish()
+}
 
-	elevator.determineNextDirection(elevio.MD_Stop)
-	elevio.SetMotorDirection(elevator.direction)
+// moves up until a floor is found. Stops the car and returns the error of `ctx` if it is done before.
+func moveToNearestFloor(ctx context.Context, driver elevio.Driver, clk clock.Clock) error {
+	if driver.GetFloor() == -1 {
+		driver.SetMotorDirection(elevio.MD_Up)
+		for driver.GetFloor() == -1 {
+			if !clock.SleepContext(ctx, clk, floorPollInterval) {
+				driver.SetMotorDirection(elevio.MD_Stop)
+				return ctx.Err()
+			}
+		}
+		driver.SetMotorDirection(elevio.MD_Stop)
+	}
+	driver.SetFloorIndicator(driver.GetFloor())
+	return nil
+}
 
-	if elevator.requests[elevator.floor][elevio.BT_Cab] {
-		elevator.openAndCloseDoor()
+// Returns the elevator which serves the button press `b`. Cab calls and all calls while offline
+// are served by this elevator, hall calls are assigned to the cheapest elevator.
+func (e *elevator) dispatch(b elevio.ButtonEvent) int {
+	if b.Button == elevio.BT_Cab || e.sync.IsOffline() {
+		return e.id
 	}
+	return e.assigner.Assign(b)
+}
 
-	return elevator
+// Journals the event `ev` and handles it until `ctx` is done.
+func (e *elevator) process(ctx context.Context, ev Event) {
+	ev.Time = e.clock.Now()
+	e.journal.record(ev)
+	e.handle(ctx, ev)
 }
 
-// moves up until a floor is found
-func moveToNearestFloor() {
-	if elevio.GetFloor() == -1 {
-		elevio.SetMotorDirection(elevio.MD_Up)
-		for elevio.GetFloor() == -1 {
-			time.Sleep(floorPollInterval)
-		}
-		elevio.SetMotorDirection(elevio.MD_Stop)
+// Handles the event `ev` and then the faults it raised, and publishes the resulting state.
+// Handling faults moves the car, which is given up once `ctx` is done.
+func (e *elevator) handle(ctx context.Context, ev Event) {
+	e.apply(ev)
+	e.handleFaults(ctx)
+	e.publish()
+}
+
+func (e *elevator) apply(ev Event) {
+	switch ev.Kind {
+	case EV_Button:
+		e.handleButtonPress(*ev.Button, *ev.AssigneeID)
+	case EV_Assignment:
+		e.handleAssignment(*ev.Button)
+	case EV_Unassignment:
+		e.handleUnassignment(*ev.Button)
+	case EV_Floor:
+		e.handleFloorChange(*ev.Floor)
+	case EV_Obstruction:
+		e.handleDoorObstruction(ev.Value)
+	case EV_Stop:
+		e.handleStopButton(ev.Value)
+	case EV_Member:
+		e.handleMemberEvent(*ev.Member)
+	case EV_Fault:
+		e.raise(ev.Fault)
+	case EV_OutOfService:
+		e.handleOutOfService(ev.Value)
 	}
-	elevio.SetFloorIndicator(elevio.GetFloor())
 }
 
-func (e *elevator) handleButtonPress(b elevio.ButtonEvent) {
-	log.Printf("Pressed button %+v\n", b)
+func (e *elevator) handleButtonPress(b elevio.ButtonEvent, assigneeID int) {
+	_log.Info("button pressed", "button", b, "assignee", assigneeID)
 
-	if b.Button == elevio.BT_Cab {
+	if e.id == assigneeID {
 		e.addRequest(b)
-	} else {
-		assigneeID := asg.Assign(b)
-		if _elevatorID == assigneeID {
-			e.addRequest(b)
-		}
 	}
 }
 
 func (e *elevator) handleAssignment(b elevio.ButtonEvent) {
-	log.Printf("Received assignment: %+v\n", b)
+	if !asg.IsHallCall(b, len(e.requests)) {
+		_log.Warn("ignoring assignment which is no hall call of ours", "call", b)
+		return
+	}
+	_log.Info("received assignment", "call", b)
 	e.addRequest(b)
 }
 
-func (e *elevator) handleFloorChange(floorNum int, errorChan chan string) {
-	log.Printf("floor changed %+v\n", floorNum)
+// Gives up a hall call which another elevator keeps after a partition healed.
+func (e *elevator) handleUnassignment(b elevio.ButtonEvent) {
+	if !asg.IsHallCall(b, len(e.requests)) {
+		_log.Warn("ignoring unassignment which is no hall call of ours", "call", b)
+		return
+	}
+	_log.Info("giving up hall call", "call", b)
+	e.requests[b.Floor][b.Button] = false
+}
+
+func (e *elevator) handleFloorChange(floorNum int) {
+	_log.Debug("floor changed", "floor", floorNum)
+	for _, fault := range e.motor.passed(floorNum) {
+		e.raise(fault)
+	}
+	if e.state != ST_Moving && floorNum == e.floor {
+		// No move, the car reached the floor it was moved to while handling a fault
+		return
+	}
 
 	switch e.state {
 	case ST_Moving:
 		e.floor = floorNum
-		elevio.SetFloorIndicator(floorNum)
+		e.driver.SetFloorIndicator(floorNum)
 
 		if e.shouldStopOnCurrentFloor() {
 			e.openAndCloseDoor()
 		}
 
 	case ST_Idle:
-		errorChan <- "Unexpected move"
-		log.Printf("Stuck in Unexpected move error")
+		e.raise("Unexpected move")
+		_log.Error("unexpected move while idle")
 	case ST_DoorOpen:
-		errorChan <- "Door open move"
-		log.Printf("Stuck in Door open move error")
+		e.raise("Door open move")
+		_log.Error("unexpected move with open door")
 	}
 }
 
-func (e *elevator) handleDoorObstruction(isObstructed bool, errorChan chan string) {
-	log.Printf("Door obstruction %+v\n", isObstructed)
+func (e *elevator) handleDoorObstruction(isObstructed bool) {
+	_log.Info("door obstruction", "obstructed", isObstructed)
+
+	if isObstructed && !e.doorObstructed {
+		e.obstructedSince = e.clock.Now()
+	} else if !isObstructed && e.doorObstructed {
+		e.metrics.obstructionDurations.Observe(e.clock.Since(e.obstructedSince).Seconds())
+	}
 
 	if e.state == ST_DoorOpen {
 		e.doorObstructed = isObstructed
-		errorChan <- "Elevator obstructed normally"
+		e.raise("Elevator obstructed normally")
 		return
 	} else {
-		errorChan <- "Door obstruction error"
+		e.raise("Door obstruction error")
 		e.doorObstructed = isObstructed
 	}
 }
 
+// Degrades the elevator while its stop button is pressed, so other elevators take over its hall
+// calls if it is held for long.
 func (e *elevator) handleStopButton(isPressed bool) {
+	_log.Info("stop button", "pressed", isPressed)
+	e.stopPressed = isPressed
+	if isPressed {
+		e.setAvailability(types.AV_Degraded)
+	} else {
+		e.setAvailability(types.AV_Available)
+	}
+}
+
+func (e *elevator) handleMemberEvent(m sts.MemberEvent) {
+	_log.Info("membership changed", "peer", m.ElevatorID, "event", m.Type, "incarnation", m.Incarnation)
+}
+
+// Takes the elevator out of service on operator request. Other elevators take over its hall calls
+// while it keeps serving its cab calls.
+func (e *elevator) handleOutOfService(outOfService bool) {
+	_log.Info("out of service", "enabled", outOfService)
+	e.outOfService = outOfService
+	if outOfService {
+		e.setAvailability(types.AV_OutOfService)
+	} else {
+		e.setAvailability(types.AV_Available)
+	}
+}
+
+// Advertises `a` to other elevators unless an operator took the elevator out of service or its
+// motor is lost or it shut down, or it is degraded while the stop button is pressed.
+func (e *elevator) setAvailability(a types.Availability) {
+	if e.stopPressed && a == types.AV_Available {
+		a = types.AV_Degraded
+	}
+	if e.outOfService || e.motor.isLost() || e.halted {
+		a = types.AV_OutOfService
+	}
+	if a != e.availability {
+		_log.Info("availability changed", "availability", a)
+	}
+	e.availability = a
+	e.publish()
 }
 
 func (e *elevator) addRequest(b elevio.ButtonEvent) {
+	if !e.requests[b.Floor][b.Button] {
+		e.requestTimes[b.Floor][b.Button] = e.clock.Now()
+	}
 	e.requests[b.Floor][b.Button] = true
-	flushRequests(e.requests)
+	e.flushRequests()
 
 	switch e.state {
 	case ST_Idle:
 		if e.floor < b.Floor {
 			e.state = ST_Moving
 			e.direction = elevio.MD_Up
-			elevio.SetMotorDirection(e.direction)
+			e.driver.SetMotorDirection(e.direction)
 		} else if e.floor > b.Floor {
 			e.state = ST_Moving
 			e.direction = elevio.MD_Down
-			elevio.SetMotorDirection(e.direction)
+			e.driver.SetMotorDirection(e.direction)
 		} else {
 			e.openAndCloseDoor()
 		}
 	case ST_Moving:
 		break
 	case ST_DoorOpen:
-		e.requests[e.floor][elevio.BT_Cab] = false
-		e.requests[e.floor][elevio.BT_HallUp] = false
-		e.requests[e.floor][elevio.BT_HallDown] = false
+		e.serveRequest(elevio.BT_Cab)
+		e.serveRequest(elevio.BT_HallUp)
+		e.serveRequest(elevio.BT_HallDown)
+	}
+}
+
+// Clears the request `btn` on the current floor since the door is open, and records how long it waited.
+func (e *elevator) serveRequest(btn elevio.ButtonType) {
+	if !e.requests[e.floor][btn] {
+		return
+	}
+	e.requests[e.floor][btn] = false
+	e.journal.record(Event{Time: e.clock.Now(), Kind: EV_Served, Button: &elevio.ButtonEvent{Floor: e.floor, Button: btn}})
+
+	requestedAt := e.requestTimes[e.floor][btn]
+	if requestedAt.IsZero() {
+		return
+	}
+	if btn == elevio.BT_Cab {
+		e.metrics.cabCallRideTime.Observe(e.clock.Since(requestedAt).Seconds())
+	} else {
+		e.metrics.hallCallWaitTime.Observe(e.clock.Since(requestedAt).Seconds())
 	}
+	e.requestTimes[e.floor][btn] = time.Time{}
 }
 
 // Opens the door and waits for all passengers to enter/exit before closing
@@ -184,9 +488,11 @@ func (e *elevator) openAndCloseDoor() {
 	prevDirection := e.direction
 	e.state = ST_DoorOpen
 	e.direction = elevio.MD_Stop
-	elevio.SetMotorDirection(e.direction)
+	e.driver.SetMotorDirection(e.direction)
 
-	elevio.SetDoorOpenLamp(true)
+	e.doorOpen = true
+	e.driver.SetDoorOpenLamp(true)
+	e.metrics.doorCycles.Inc()
 
 	e.clearRequestsOnCurrentFloor(prevDirection)
 }
@@ -231,55 +537,62 @@ func (e *elevator) clearRequestsOnCurrentFloor(d elevio.MotorDirection) {
 
 	// Clear cab requests
 	if e.requests[e.floor][elevio.BT_Cab] {
-		e.requests[e.floor][elevio.BT_Cab] = false
+		e.serveRequest(elevio.BT_Cab)
 		delay = doorOpenDelay
 	}
 
 	// Clear same direction hall calls
 	if d == elevio.MD_Up && e.requests[e.floor][elevio.BT_HallUp] {
-		e.requests[e.floor][elevio.BT_HallUp] = false
+		e.serveRequest(elevio.BT_HallUp)
 		delay = doorOpenDelay
 	} else if d == elevio.MD_Down && e.requests[e.floor][elevio.BT_HallDown] {
-		e.requests[e.floor][elevio.BT_HallDown] = false
+		e.serveRequest(elevio.BT_HallDown)
 		delay = doorOpenDelay
 	} else if d == elevio.MD_Stop {
-		e.requests[e.floor][elevio.BT_HallUp] = false
-		e.requests[e.floor][elevio.BT_HallDown] = false
+		e.serveRequest(elevio.BT_HallUp)
+		e.serveRequest(elevio.BT_HallDown)
 		delay = doorOpenDelay
 	}
 
-	flushRequests(e.requests)
+	e.flushRequests()
 
-	time.AfterFunc(delay, func() {
-		e.clearOppositeDirectionRequests(d)
-	})
+	e.after(delay, timeout{kind: TO_OppositeCalls, direction: d})
 }
 
 func (e *elevator) clearOppositeDirectionRequests(d elevio.MotorDirection) {
 	delay := 0 * time.Second
 	if d == elevio.MD_Up && !hasRequestAbove(e.floor, e.requests) {
 		if e.requests[e.floor][elevio.BT_HallDown] {
-			e.requests[e.floor][elevio.BT_HallDown] = false
+			e.serveRequest(elevio.BT_HallDown)
 			delay = doorOpenDelay
 		}
 	} else if d == elevio.MD_Down && !hasRequestBelow(e.floor, e.requests) {
 		if e.requests[e.floor][elevio.BT_HallUp] {
-			e.requests[e.floor][elevio.BT_HallUp] = false
+			e.serveRequest(elevio.BT_HallUp)
 			delay = doorOpenDelay
 		}
 	}
-	time.AfterFunc(delay, func() {
-		for e.doorObstructed {
-			time.Sleep(floorPollInterval)
-		}
-		elevio.SetDoorOpenLamp(false)
+	e.after(delay, timeout{kind: TO_CloseDoor, direction: d})
+}
 
-		e.determineNextDirection(d)
+// Closes the door and continues in the direction of travel `d` if there are calls left. An
+// obstructed door is kept open and checked again every `floorPollInterval`.
+func (e *elevator) closeDoor(d elevio.MotorDirection) {
+	if e.halted {
+		return
+	}
+	if e.doorObstructed {
+		e.after(floorPollInterval, timeout{kind: TO_CloseDoor, direction: d})
+		return
+	}
+	e.doorOpen = false
+	e.driver.SetDoorOpenLamp(false)
 
-		elevio.SetMotorDirection(e.direction)
+	e.determineNextDirection(d)
 
-		sts.EnableHeartbeat()
-	})
+	e.driver.SetMotorDirection(e.direction)
+
+	e.setAvailability(types.AV_Available)
 }
 
 func (e *elevator) determineNextDirection(d elevio.MotorDirection) {
@@ -302,11 +615,20 @@ func (e *elevator) determineNextDirection(d elevio.MotorDirection) {
 	}
 }
 
-func setButtonLights(requests [][3]bool) {
-	ticker := time.NewTicker(20 * time.Millisecond)
-	defer ticker.Stop()
+// Signals the lamps that our requests changed, unless a signal is pending anyway.
+func (e *elevator) signalRequestsChanged() {
+	select {
+	case e.requestsChanged <- struct{}{}:
+	default:
+	}
+}
 
-	prevLights := make([][3]bool, len(requests))
+// Keeps the lamps showing our requests and the hall calls of all alive elevators, updating them
+// whenever our requests change or a state, failure or departure arrives on `changes`, until `ctx`
+// is done or `changes` is closed.
+func (e *elevator) setButtonLights(ctx context.Context, changes <-chan sts.Change) {
+	peerRequests := make(map[int][][3]bool) // of the last state received from each alive elevator
+	prevLights := make([][3]bool, len(e.requests))
 
 	for i := range prevLights {
 		for j := range prevLights[i] {
@@ -314,62 +636,129 @@ func setButtonLights(requests [][3]bool) {
 		}
 	}
 
-	for range ticker.C {
-		currLights := sts.GetOrAggregatedLiveRequests(requests)
+	for {
+		currLights := e.GetRequests()
+		for _, requests := range peerRequests {
+			for floor := range currLights {
+				currLights[floor][elevio.BT_HallUp] = currLights[floor][elevio.BT_HallUp] || requests[floor][elevio.BT_HallUp]
+				currLights[floor][elevio.BT_HallDown] = currLights[floor][elevio.BT_HallDown] || requests[floor][elevio.BT_HallDown]
+			}
+		}
 
 		for r := range len(currLights) {
 			for b := range len(currLights[0]) {
 				if prevLights[r][b] != currLights[r][b] {
-					elevio.SetButtonLamp(elevio.ButtonType(b), r, currLights[r][b])
+					e.driver.SetButtonLamp(elevio.ButtonType(b), r, currLights[r][b])
 					prevLights[r][b] = currLights[r][b]
 				}
 			}
 		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			switch change.Kind {
+			case sts.CK_StateUpdated:
+				peerRequests[change.ElevatorID] = change.State.GetRequests()
+			case sts.CK_PeerFailed, sts.CK_PeerLeft:
+				delete(peerRequests, change.ElevatorID)
+			}
+		case <-e.requestsChanged:
+		}
 	}
 }
 
-func (e *elevator) processElevatorErrors(errorChan chan string) {
-	for {
-		err := <-errorChan
+// Raises the fault `description`, which is handled once the current event was handled.
+func (e *elevator) raise(description string) {
+	e.raised = append(e.raised, description)
+}
+
+// Records and handles the faults raised, in order, until `ctx` is done. Once the elevator shut
+// down, faults are only recorded.
+func (e *elevator) handleFaults(ctx context.Context) {
+	for len(e.raised) > 0 {
+		err := e.raised[0]
+		e.raised = e.raised[1:]
+
+		e.faults.record(err, e.clock.Now())
+		if e.halted {
+			continue
+		}
 		switch err {
 		case "Unexpected move", "Door open move":
-			e.handleUnexpectedMove()
+			e.handleUnexpectedMove(ctx)
 
 		case "Door obstruction error", "Elevator obstructed normally":
-			e.handleDoorObstructionError()
+			e.handleDoorObstructionError(ctx)
 
-		case "Elevator stuck":
-			e.handleElevatorStuck()
+		case faultMotorLost, faultWrongDirection:
+			e.handleMotorLost()
+
+		case faultMotorRecovered:
+			e.handleMotorRecovered()
 		}
 	}
 }
 
-func (e *elevator) handleUnexpectedMove() {
-	sts.DisableHeartbeat()
-	if elevio.GetFloor() != -1 {
+func (e *elevator) handleUnexpectedMove(ctx context.Context) {
+	e.setAvailability(types.AV_Degraded)
+	if e.driver.GetFloor() != -1 {
 		e.resetToIdle()
 	} else {
-		moveToNearestFloor()
+		if !e.moveToNearestFloor(ctx) {
+			return
+		}
 		e.openAndCloseDoor()
 	}
-	sts.EnableHeartbeat()
+	e.setAvailability(types.AV_Available)
 }
 
-func (e *elevator) handleDoorObstructionError() {
-	sts.DisableHeartbeat()
-	moveToNearestFloor()
+func (e *elevator) handleDoorObstructionError(ctx context.Context) {
+	e.setAvailability(types.AV_Degraded)
+	if !e.moveToNearestFloor(ctx) {
+		return
+	}
 	e.openAndCloseDoor()
 }
 
-func (e *elevator) handleElevatorStuck() {
-	sts.DisableHeartbeat()
-	moveToNearestFloor()
-	sts.EnableHeartbeat()
+// Moves the car to the nearest floor, which becomes the current floor and is journaled if the car
+// moved. Like every handler it blocks the main event loop, until the car reached a floor or `ctx`
+// is done. Reports whether the car reached a floor, it stands between floors otherwise and the
+// elevator is shutting down.
+func (e *elevator) moveToNearestFloor(ctx context.Context) bool {
+	between := e.driver.GetFloor() == -1
+	if err := moveToNearestFloor(ctx, e.driver, e.clock); err != nil {
+		_log.Warn("gave up moving to the nearest floor", "err", err)
+		return false
+	}
+	e.floor = e.driver.GetFloor()
+	if between {
+		// Replays cannot tell which floor the car reached otherwise
+		floor := e.floor
+		e.journal.record(Event{Time: e.clock.Now(), Kind: EV_NearestFloor, Floor: &floor})
+	}
+	return true
+}
+
+// Hands the hall calls of the elevator over to the others while its motor is lost. The motor
+// stays commanded, so the car continues as soon as it moves again.
+func (e *elevator) handleMotorLost() {
+	_log.Error("motor lost, handing over hall calls")
+	e.setAvailability(types.AV_OutOfService)
+}
+
+func (e *elevator) handleMotorRecovered() {
+	_log.Info("motor recovered")
+	e.setAvailability(types.AV_Available)
 }
 
 func (e *elevator) resetToIdle() {
-	e.floor = elevio.GetFloor()
-	elevio.SetFloorIndicator(e.floor)
-	elevio.SetMotorDirection(elevio.MD_Stop)
+	e.floor = e.driver.GetFloor()
+	e.driver.SetFloorIndicator(e.floor)
+	e.driver.SetMotorDirection(elevio.MD_Stop)
 	e.state = ST_Idle
 }
@@ -1,15 +1,24 @@
 package controller
 
 import (
+	"context"
+	"elevator/clock"
+	"elevator/elevio"
+	sts "elevator/statesync"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCabCallCache_FlushThenRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultCabCallCache)
 	requests := [][3]bool{{true, false, false}, {false, true, true}, {true, true, true}}
-	flushRequests(requests)
-	result := restoreRequests(3)
+	flushRequests(path, requests)
+	result := restoreRequests(path, 3)
 	expected := [][3]bool{{false, false, false}, {false, false, true}, {false, false, true}}
 
 	if !reflect.DeepEqual(result, expected) {
@@ -17,8 +26,30 @@ func TestCabCallCache_FlushThenRestore(t *testing.T) {
 	}
 }
 
+func TestCabCallCache_MigratesLegacyCache(t *testing.T) {
+	dir := t.TempDir()
+	legacy, path := filepath.Join(dir, DefaultCabCallCache), filepath.Join(dir, defaultCabCallCache(1))
+	flushRequests(legacy, [][3]bool{{false, false, true}, {false, false, false}, {false, false, true}})
+
+	migrateCabCallCache(legacy, path)
+	expected := [][3]bool{{false, false, true}, {false, false, false}, {false, false, true}}
+	if result := restoreRequests(path, 3); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected the cab calls of the legacy cache, was %+v", result)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("Expected the legacy cache to be moved, was %v", err)
+	}
+
+	flushRequests(legacy, [][3]bool{{false, false, false}, {false, false, true}, {false, false, false}})
+	migrateCabCallCache(legacy, path)
+	if result := restoreRequests(path, 3); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected an existing cache to be kept, was %+v", result)
+	}
+}
+
 func TestCabCallCache_RestoreOnly(t *testing.T) {
-	file, _ := os.OpenFile(hallCallStatePath, os.O_CREATE|os.O_WRONLY, 0644)
+	path := filepath.Join(t.TempDir(), DefaultCabCallCache)
+	file, _ := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
 	defer file.Close()
 
 	hallCalls := [...]bool{true, false, true}
@@ -31,10 +62,97 @@ func TestCabCallCache_RestoreOnly(t *testing.T) {
 		}
 	}
 
-	result := restoreRequests(3)
+	result := restoreRequests(path, 3)
 	expected := [][3]bool{{false, false, true}, {false, false, false}, {false, false, true}}
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Restored requests not as expected.\nExpected: %+v\nWas: %+v", expected, result)
 	}
 }
+
+// doorDriver records the door lamp of an elevator which never leaves its floor.
+type doorDriver struct {
+	mtx      sync.Mutex
+	doorOpen bool
+}
+
+func (d *doorDriver) SetMotorDirection(dir elevio.MotorDirection)                   {}
+func (d *doorDriver) SetButtonLamp(button elevio.ButtonType, floor int, value bool) {}
+func (d *doorDriver) SetFloorIndicator(floor int)                                   {}
+func (d *doorDriver) GetFloor() int                                                 { return 0 }
+
+func (d *doorDriver) SetDoorOpenLamp(value bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.doorOpen = value
+}
+
+func (d *doorDriver) isDoorOpen() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return d.doorOpen
+}
+
+func TestElevator_KeepsObstructedDoorOpen(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	driver := &doorDriver{}
+	e := newElevator(0, driver, clk, 0, make([][3]bool, 4))
+	e.sync = sts.New(e, nil, clk, nil, nil, nil)
+	e.start()
+
+	e.addRequest(elevio.ButtonEvent{Floor: 0, Button: elevio.BT_Cab})
+	advanceTo(e, clk, clk.Now().Add(doorOpenDelay-100*time.Millisecond))
+	if !driver.isDoorOpen() {
+		t.Fatal("Expected the door to be open before the delay passed")
+	}
+
+	e.handleDoorObstruction(true)
+	advanceTo(e, clk, clk.Now().Add(time.Second))
+	if !driver.isDoorOpen() {
+		t.Fatal("Expected the obstructed door to stay open")
+	}
+
+	e.handleDoorObstruction(false)
+	advanceTo(e, clk, clk.Now().Add(100*time.Millisecond))
+	if driver.isDoorOpen() {
+		t.Error("Expected the door to close once the obstruction cleared")
+	}
+}
+
+func TestElevator_BetweenFloorsFollowsFloorSensor(t *testing.T) {
+	driver := &replayDriver{out: io.Discard, clock: clock.Real{}, floor: 1}
+	e := newElevator(0, driver, clock.Real{}, 1, make([][3]bool, 4))
+	e.driver.SetMotorDirection(elevio.MD_Up)
+	if e.IsBetweenFloors() {
+		t.Error("Expected the car to be at its floor until the sensor loses it")
+	}
+	driver.setFloor(-1)
+	if !e.IsBetweenFloors() {
+		t.Error("Expected the car to be between floors once the sensor lost the floor")
+	}
+}
+
+func TestElevator_GivesUpMovingToFloorOnceContextDone(t *testing.T) {
+	driver := &replayDriver{out: io.Discard, clock: clock.Real{}, floor: -1}
+	e := newElevator(0, driver, clock.Real{}, 1, make([][3]bool, 4))
+	e.sync = sts.New(e, nil, clock.Real{}, nil, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	handled := make(chan struct{})
+	go func() {
+		e.raise("Door obstruction error")
+		e.handleFaults(ctx)
+		close(handled)
+	}()
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected handling the fault to return once the context is done")
+	}
+	if e.floor != 1 || e.doorOpen {
+		t.Errorf("Expected the car to stay at floor 1 with the door closed, was at %d with the door open %t", e.floor, e.doorOpen)
+	}
+}
@@ -1,6 +1,15 @@
 package controller
 
-import "elevator/elevio"
+import (
+	asg "elevator/assigner"
+	"elevator/clock"
+	"elevator/elevio"
+	sts "elevator/statesync"
+	"elevator/types"
+	"slices"
+	"sync"
+	"time"
+)
 
 type stateFSM int
 
@@ -12,11 +21,95 @@ const (
 
 type elevator struct {
 	id             int
+	driver         elevio.Driver
+	floorSensor    func() int // reads the floor sensor, safe from any goroutine
+	motor          *motorSupervisor
+	clock          clock.Clock
+	metrics        *elevatorMetrics
+	sync           *sts.Sync
+	assigner       *asg.Assigner
 	state          stateFSM
 	floor          int
 	direction      elevio.MotorDirection
 	requests       [][3]bool
+	doorOpen       bool
 	doorObstructed bool
+	outOfService   bool
+	stopPressed    bool
+	halted         bool               // set on shutdown, the car then stays where it stopped
+	availability   types.Availability // advertised to other elevators
+	capacity       int                // passengers the car takes, 0 if unknown
+
+	requestsChanged chan struct{}  // signalled whenever `requests` changed, to update the lamps
+	timeouts        *timeoutQueue  // timers which ran out, handled by the main event loop
+	requestTimes    [][3]time.Time // when each request was added, for metrics
+	obstructedSince time.Time
+	raised          []string // faults raised by the event being handled
+	faults          faultLog
+
+	publishedMtx sync.Mutex
+	published    stateSnapshot // read by statesync and the lamps
+
+	journal      *journal // nil if events are not journaled
+	cabCallCache string   // path cab calls are written to, empty if they are not persisted
+}
+
+// stateSnapshot is the state of the elevator as last published to statesync and the lamps.
+type stateSnapshot struct {
+	floor        int
+	direction    elevio.MotorDirection
+	availability types.Availability
+	behaviour    types.Behaviour
+	doorOpen     bool
+	obstructed   bool
+	requests     [][3]bool
+}
+
+// Publishes the current state to statesync and the lamps, which read it from their own
+// goroutines through the getters below, and signals the lamps if the requests changed.
+func (e *elevator) publish() {
+	snapshot := stateSnapshot{
+		floor:        e.floor,
+		direction:    e.direction,
+		availability: e.availability,
+		behaviour:    e.behaviour(),
+		doorOpen:     e.doorOpen,
+		obstructed:   e.doorObstructed,
+		requests:     e.copyRequests(),
+	}
+
+	e.publishedMtx.Lock()
+	changed := !slices.Equal(snapshot.requests, e.published.requests)
+	e.published = snapshot
+	e.publishedMtx.Unlock()
+
+	if changed {
+		e.signalRequestsChanged()
+	}
+}
+
+// Returns the state last published.
+func (e *elevator) snapshot() stateSnapshot {
+	e.publishedMtx.Lock()
+	defer e.publishedMtx.Unlock()
+
+	return e.published
+}
+
+func (e *elevator) behaviour() types.Behaviour {
+	switch e.state {
+	case ST_Moving:
+		return types.BH_Moving
+	case ST_DoorOpen:
+		return types.BH_DoorOpen
+	}
+	return types.BH_Idle
+}
+
+func (e *elevator) copyRequests() [][3]bool {
+	requestsCopy := make([][3]bool, len(e.requests))
+	copy(requestsCopy, e.requests)
+	return requestsCopy
 }
 
 func (e *elevator) GetID() int {
@@ -24,19 +117,38 @@ func (e *elevator) GetID() int {
 }
 
 func (e *elevator) GetFloor() int {
-	return e.floor
+	return e.snapshot().floor
 }
 
 func (e *elevator) GetDirection() elevio.MotorDirection {
-	return e.direction
+	return e.snapshot().direction
+}
+
+func (e *elevator) GetAvailability() types.Availability {
+	return e.snapshot().availability
+}
+
+func (e *elevator) GetBehaviour() types.Behaviour {
+	return e.snapshot().behaviour
+}
+
+func (e *elevator) IsDoorOpen() bool {
+	return e.snapshot().doorOpen
+}
+
+func (e *elevator) IsObstructed() bool {
+	return e.snapshot().obstructed
+}
+
+// Reads the floor sensor, which detects no floor while the car is between floors.
+func (e *elevator) IsBetweenFloors() bool {
+	return e.floorSensor() == -1
+}
+
+func (e *elevator) GetCapacity() int {
+	return e.capacity
 }
 
 func (e *elevator) GetRequests() [][3]bool {
-	requestsCopy := make([][3]bool, len(e.requests))
-	for i, requests := range e.requests {
-		requestsCopy[i][elevio.BT_HallUp] = requests[elevio.BT_HallUp]
-		requestsCopy[i][elevio.BT_HallDown] = requests[elevio.BT_HallDown]
-		requestsCopy[i][elevio.BT_Cab] = requests[elevio.BT_Cab]
-	}
-	return requestsCopy
+	return slices.Clone(e.snapshot().requests)
 }
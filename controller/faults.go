@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"elevator/api"
+	"sync"
+	"time"
+)
+
+const faultLogSize = 50
+
+// faultLog keeps the most recent faults reported by the elevator.
+type faultLog struct {
+	mtx    sync.Mutex
+	faults []api.Fault
+}
+
+// Records the fault `description` detected at `at`.
+func (l *faultLog) record(description string, at time.Time) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.faults = append(l.faults, api.Fault{Time: at, Description: description})
+	if len(l.faults) > faultLogSize {
+		l.faults = l.faults[len(l.faults)-faultLogSize:]
+	}
+}
+
+func (l *faultLog) recent() []api.Fault {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return append([]api.Fault(nil), l.faults...)
+}
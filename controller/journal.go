@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"bufio"
+	"elevator/clock"
+	"elevator/elevio"
+	sts "elevator/statesync"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type EventKind string
+
+const (
+	EV_Start        EventKind = "start"
+	EV_Button       EventKind = "button"
+	EV_Assignment   EventKind = "assignment"
+	EV_Unassignment EventKind = "unassignment"
+	EV_Floor        EventKind = "floor"
+	EV_Obstruction  EventKind = "obstruction"
+	EV_Stop         EventKind = "stop"
+	EV_Member       EventKind = "member"
+	EV_OutOfService EventKind = "out_of_service"
+	EV_Fault        EventKind = "fault"
+	EV_NearestFloor EventKind = "nearest_floor" // reached while handling the event before, not handled itself
+
+	// Outputs of the controller, journaled for analysis and skipped by replays
+	EV_Motor  EventKind = "motor"
+	EV_Door   EventKind = "door"
+	EV_Served EventKind = "served"
+)
+
+// IsOutput reports whether events of kind `k` are outputs of the controller rather than inputs.
+func (k EventKind) IsOutput() bool {
+	return k == EV_Motor || k == EV_Door || k == EV_Served
+}
+
+// Event is an input consumed by the main event loop or an output of the controller. Every input
+// carries what the controller needs to make the same decision again, e.g. which elevator dispatch
+// picked for a button press.
+type Event struct {
+	Time time.Time `json:"time"`
+	Kind EventKind `json:"kind"`
+
+	Button     *elevio.ButtonEvent    `json:"button,omitempty"`     // button, assignment, unassignment and served
+	AssigneeID *int                   `json:"assigneeID,omitempty"` // button: elevator which serves the call
+	Floor      *int                   `json:"floor,omitempty"`      // start, floor and nearest floor
+	Value      bool                   `json:"value,omitempty"`      // obstruction, stop, out of service and door
+	Member     *sts.MemberEvent       `json:"member,omitempty"`
+	Fault      string                 `json:"fault,omitempty"`     // faults detected outside of the controller
+	Direction  *elevio.MotorDirection `json:"direction,omitempty"` // motor
+
+	ElevatorID int       `json:"elevatorID,omitempty"` // start
+	Requests   [][3]bool `json:"requests,omitempty"`   // start: requests restored from the cab call cache
+}
+
+// journal appends events as JSON lines to `w`. A nil journal discards all events.
+type journal struct {
+	mtx  sync.Mutex
+	name string
+	w    io.Writer
+	enc  *json.Encoder
+}
+
+func newJournal(w io.Writer, name string) *journal {
+	return &journal{name: name, w: w, enc: json.NewEncoder(w)}
+}
+
+func openJournal(path string) (*journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return newJournal(file, path), nil
+}
+
+// Closes the file of a journal opened with `openJournal`.
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if closer, ok := j.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (j *journal) record(ev Event) {
+	if j == nil {
+		return
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if err := j.enc.Encode(ev); err != nil {
+		_log.Error("writing journal failed", "journal", j.name, "err", err)
+	}
+}
+
+// ReadJournal reads all runs from a journal. Every run starts with an `EV_Start` event, since a
+// restarted elevator appends to the journal of its previous run.
+func ReadJournal(r io.Reader) ([][]Event, error) {
+	runs := make([][]Event, 0, 1)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ev.Kind == EV_Start {
+			runs = append(runs, nil)
+		} else if len(runs) == 0 {
+			return nil, fmt.Errorf("line %d: %s event before the start of a run", line, ev.Kind)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], ev)
+	}
+	return runs, scanner.Err()
+}
+
+func (ev Event) String() string {
+	switch ev.Kind {
+	case EV_Start:
+		return fmt.Sprintf("start elevator=%d floor=%d", ev.ElevatorID, *ev.Floor)
+	case EV_Button:
+		return fmt.Sprintf("button floor=%d button=%d assignee=%d", ev.Button.Floor, ev.Button.Button, *ev.AssigneeID)
+	case EV_Assignment, EV_Unassignment:
+		return fmt.Sprintf("%s floor=%d button=%d", ev.Kind, ev.Button.Floor, ev.Button.Button)
+	case EV_Floor:
+		return fmt.Sprintf("floor %d", *ev.Floor)
+	case EV_NearestFloor:
+		return fmt.Sprintf("nearest floor %d", *ev.Floor)
+	case EV_Obstruction, EV_Stop, EV_OutOfService:
+		return fmt.Sprintf("%s %v", ev.Kind, ev.Value)
+	case EV_Member:
+		return fmt.Sprintf("member elevator=%d %v", ev.Member.ElevatorID, ev.Member.Type)
+	case EV_Fault:
+		return fmt.Sprintf("fault %q", ev.Fault)
+	case EV_Motor:
+		return fmt.Sprintf("motor %d", *ev.Direction)
+	case EV_Door:
+		return fmt.Sprintf("door open %v", ev.Value)
+	case EV_Served:
+		return fmt.Sprintf("served floor=%d button=%d", ev.Button.Floor, ev.Button.Button)
+	}
+	return string(ev.Kind)
+}
+
+// journaledDriver journals the motor direction and the door whenever the controller changes them.
+type journaledDriver struct {
+	elevio.Driver
+	journal *journal
+	clock   clock.Clock
+
+	mtx       sync.Mutex
+	direction elevio.MotorDirection
+	doorOpen  bool
+}
+
+func (d *journaledDriver) SetMotorDirection(dir elevio.MotorDirection) {
+	d.Driver.SetMotorDirection(dir)
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if dir != d.direction {
+		d.direction = dir
+		d.journal.record(Event{Time: d.clock.Now(), Kind: EV_Motor, Direction: &dir})
+	}
+}
+
+func (d *journaledDriver) SetDoorOpenLamp(value bool) {
+	d.Driver.SetDoorOpenLamp(value)
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if value != d.doorOpen {
+		d.doorOpen = value
+		d.journal.record(Event{Time: d.clock.Now(), Kind: EV_Door, Value: value})
+	}
+}
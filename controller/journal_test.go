@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"elevator/clock"
+	"elevator/elevio"
+	sts "elevator/statesync"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournal_RecordThenRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	floor, assigneeID := 1, 2
+
+	// Two runs, as written by an elevator which restarted
+	for range 2 {
+		j, err := openJournal(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.record(Event{Kind: EV_Start, ElevatorID: 2, Floor: &floor, Requests: make([][3]bool, 4)})
+		j.record(Event{Kind: EV_Button, Button: &elevio.ButtonEvent{Floor: 3, Button: elevio.BT_HallUp}, AssigneeID: &assigneeID})
+		j.record(Event{Kind: EV_Obstruction, Value: true})
+		j.w.(*os.File).Close()
+	}
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	runs, err := ReadJournal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 2 || len(runs[1]) != 3 {
+		t.Fatalf("Expected 2 runs of 3 events, was %+v", runs)
+	}
+	if ev := runs[1][1]; ev.Kind != EV_Button || *ev.AssigneeID != 2 || ev.Button.Floor != 3 {
+		t.Errorf("Button event not as expected: %v", ev)
+	}
+	if ev := runs[1][2]; ev.Kind != EV_Obstruction || !ev.Value {
+		t.Errorf("Obstruction event not as expected: %v", ev)
+	}
+
+	if _, err := ReadJournal(strings.NewReader(`{"kind": "floor", "floor": 2}`)); err == nil {
+		t.Errorf("Expected journal without start event to be rejected")
+	}
+}
+
+func TestReplay_ReproducesDecisions(t *testing.T) {
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	startFloor, floor1, floor2, self, other := 0, 1, 2, 0, 1
+	run := []Event{
+		{Time: at(0), Kind: EV_Start, ElevatorID: 0, Floor: &startFloor, Requests: make([][3]bool, 4)},
+		{Time: at(5), Kind: EV_Button, Button: &elevio.ButtonEvent{Floor: 3, Button: elevio.BT_HallDown}, AssigneeID: &other},
+		{Time: at(10), Kind: EV_Button, Button: &elevio.ButtonEvent{Floor: 2, Button: elevio.BT_Cab}, AssigneeID: &self},
+		{Time: at(20), Kind: EV_Floor, Floor: &floor1},
+		{Time: at(30), Kind: EV_Floor, Floor: &floor2},
+	}
+
+	var out strings.Builder
+	if err := Replay(run, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hall call was served by another elevator, so the elevator only moves for its cab call.
+	// The replay clock closes the door exactly `doorOpenDelay` after it opened.
+	expected := []string{"motor stop", "< button floor=3 button=1 assignee=1", "motor up", "floor indicator 1", "floor indicator 2",
+		"+30ms > door open lamp true", "+3.03s > door open lamp false"}
+	lines := out.String()
+	for _, line := range expected {
+		index := strings.Index(lines, line)
+		if index < 0 {
+			t.Fatalf("Expected %q in order in replay:\n%s", line, out.String())
+		}
+		lines = lines[index+len(line):]
+	}
+	if strings.Count(out.String(), "motor up") != 1 {
+		t.Errorf("Expected the elevator to start moving once:\n%s", out.String())
+	}
+}
+
+// jammedDriver is a car whose motor jammed between floors, which reaches `reach` once it is moved
+// up again.
+type jammedDriver struct {
+	replayDriver
+	reach int
+}
+
+func (d *jammedDriver) SetMotorDirection(dir elevio.MotorDirection) {
+	d.replayDriver.SetMotorDirection(dir)
+	if dir == elevio.MD_Up && d.replayDriver.GetFloor() == -1 {
+		d.setFloor(d.reach)
+	}
+}
+
+// Returns the outputs printed by a replay or driver, without the inputs.
+func outputsOf(printed string) []string {
+	var outputs []string
+	for _, line := range strings.Split(printed, "\n") {
+		if strings.Contains(line, " > ") {
+			outputs = append(outputs, line)
+		}
+	}
+	return outputs
+}
+
+func TestReplay_FollowsRecoveryFromJam(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	var live strings.Builder
+	driver := &jammedDriver{replayDriver: replayDriver{out: &live, clock: clk, startedAt: start}, reach: 1}
+	e := newElevator(0, driver, clk, 0, make([][3]bool, 4))
+	e.sync = sts.New(e, nil, clk, nil, nil, nil)
+	var journaled bytes.Buffer
+	e.journal = newJournal(&journaled, "journal")
+	floor, self := 0, 0
+	e.journal.record(Event{Time: clk.Now(), Kind: EV_Start, ElevatorID: 0, Floor: &floor, Requests: e.copyRequests()})
+	e.start()
+
+	// The car leaves for its cab call and jams between floors, then the door is obstructed, which
+	// moves it on to the nearest floor
+	ctx := context.Background()
+	e.process(ctx, Event{Kind: EV_Button, Button: &elevio.ButtonEvent{Floor: 2, Button: elevio.BT_Cab}, AssigneeID: &self})
+	advanceTo(e, clk, clk.Now().Add(500*time.Millisecond))
+	driver.setFloor(-1)
+	e.process(ctx, Event{Kind: EV_Fault, Fault: faultMotorLost})
+	advanceTo(e, clk, clk.Now().Add(time.Second))
+	e.process(ctx, Event{Kind: EV_Obstruction, Value: true})
+	advanceTo(e, clk, clk.Now().Add(time.Second))
+	e.process(ctx, Event{Kind: EV_Obstruction, Value: false})
+	e.process(ctx, Event{Kind: EV_Fault, Fault: faultMotorRecovered})
+	advanceTo(e, clk, clk.Now().Add(replaySettleTime))
+
+	if !strings.Contains(journaled.String(), `"nearest_floor"`) {
+		t.Errorf("Expected the floor reached after the jam to be journaled:\n%s", journaled.String())
+	}
+	runs, err := ReadJournal(&journaled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replayed strings.Builder
+	if err := Replay(runs[0], &replayed); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, was := outputsOf(live.String()), outputsOf(replayed.String())
+	if !slices.Equal(was, expected) {
+		t.Errorf("Expected the replay to reproduce the outputs of the run.\nRun:\n%s\nReplay:\n%s",
+			strings.Join(expected, "\n"), strings.Join(was, "\n"))
+	}
+}
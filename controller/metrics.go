@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"elevator/metrics"
+	"strconv"
+)
+
+var waitBuckets = []float64{1, 2, 5, 10, 20, 30, 60, 120}
+
+// elevatorMetrics are the metrics of one elevator, labelled with its ID since several elevators
+// may run in one process.
+type elevatorMetrics struct {
+	hallCallWaitTime     *metrics.Histogram
+	cabCallRideTime      *metrics.Histogram
+	doorCycles           *metrics.Counter
+	obstructionDurations *metrics.Histogram
+}
+
+func newElevatorMetrics(id int) *elevatorMetrics {
+	elevator := strconv.Itoa(id)
+	return &elevatorMetrics{
+		hallCallWaitTime:     metrics.NewHistogram("elevator_hall_call_wait_seconds", "Time from a hall call until the door opens at its floor.", waitBuckets, "elevator", elevator),
+		cabCallRideTime:      metrics.NewHistogram("elevator_cab_call_ride_seconds", "Time from a cab call until the door opens at its floor.", waitBuckets, "elevator", elevator),
+		doorCycles:           metrics.NewCounter("elevator_door_cycles_total", "Number of times the door opened.", "elevator", elevator),
+		obstructionDurations: metrics.NewHistogram("elevator_obstruction_seconds", "Duration of door obstructions.", []float64{0.5, 1, 2, 5, 10, 30, 60}, "elevator", elevator),
+	}
+}
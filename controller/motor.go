@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"elevator/clock"
+	"elevator/elevio"
+	"sync"
+	"time"
+)
+
+// DefaultTravelTime is the time the car of the hardware simulator takes from one floor to the
+// next, including the time its floor sensor is active.
+const DefaultTravelTime = 2500 * time.Millisecond
+
+// Faults detected by the motor supervisor.
+const (
+	faultMotorLost      = "Motor lost"
+	faultWrongDirection = "Motor wrong direction"
+	faultFloorSkipped   = "Floor skipped"
+	faultMotorRecovered = "Motor recovered"
+)
+
+// Returns how long the car may take to reach the next floor before the motor is declared lost.
+func motorTimeout(travelTime time.Duration) time.Duration {
+	return travelTime + travelTime/2
+}
+
+// motorSupervisor checks that the car reaches the next floor in the commanded direction within
+// `motorTimeout` of leaving a floor. The motor is lost if it does not, or if the car moves in the
+// wrong direction, until the car arrives at a floor in the commanded direction again.
+type motorSupervisor struct {
+	mtx        sync.Mutex
+	clock      clock.Clock
+	travelTime time.Duration      // zero disables the timeout
+	report     func(fault string) // called with missing arrivals, must not block
+
+	direction  elevio.MotorDirection // last direction commanded
+	floor      int                   // last floor passed
+	lost       bool
+	deadline   clock.Timer
+	generation int // incremented whenever the deadline is rearmed or stopped
+}
+
+func newMotorSupervisor(clk clock.Clock, floor int) *motorSupervisor {
+	return &motorSupervisor{clock: clk, floor: floor}
+}
+
+// Reports missing arrivals to `report` if the car takes longer than `travelTime` per floor by
+// more than the margin. Must be called before the motor is started.
+func (m *motorSupervisor) supervise(travelTime time.Duration, report func(fault string)) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.travelTime = travelTime
+	m.report = report
+}
+
+// Records that the motor was commanded to `dir`.
+func (m *motorSupervisor) commanded(dir elevio.MotorDirection) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if dir == m.direction {
+		return
+	}
+	m.direction = dir
+	m.rearm()
+}
+
+// Records that the car passed `floor` and returns the faults detected. The car moved in the
+// wrong direction if it passed a floor behind it, and skipped floors if it passed one further
+// away than the next.
+func (m *motorSupervisor) passed(floor int) []string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var faults []string
+	prev := m.floor
+	m.floor = floor
+	switch {
+	case (m.direction == elevio.MD_Up && floor < prev) || (m.direction == elevio.MD_Down && floor > prev):
+		if !m.lost {
+			m.lost = true
+			faults = append(faults, faultWrongDirection)
+		}
+		m.rearm()
+		return faults
+	case floor-prev > 1 || prev-floor > 1:
+		faults = append(faults, faultFloorSkipped)
+	}
+	if m.lost {
+		m.lost = false
+		faults = append(faults, faultMotorRecovered)
+	}
+	m.rearm()
+	return faults
+}
+
+// Reports whether the motor is lost.
+func (m *motorSupervisor) isLost() bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.lost
+}
+
+// Restarts the deadline for reaching the next floor while the motor runs. Must be called while
+// holding `mtx`.
+func (m *motorSupervisor) rearm() {
+	m.generation++
+	if m.deadline != nil {
+		m.deadline.Stop()
+		m.deadline = nil
+	}
+	if m.direction == elevio.MD_Stop || m.travelTime == 0 {
+		return
+	}
+	generation := m.generation
+	m.deadline = m.clock.AfterFunc(motorTimeout(m.travelTime), func() { m.expire(generation) })
+}
+
+// Declares the motor lost since the car did not reach the next floor in time.
+func (m *motorSupervisor) expire(generation int) {
+	m.mtx.Lock()
+	if generation != m.generation || m.lost {
+		m.mtx.Unlock()
+		return
+	}
+	m.lost = true
+	timeout, report := motorTimeout(m.travelTime), m.report
+	m.mtx.Unlock()
+
+	_log.Error("car did not reach the next floor in time", "timeout", timeout)
+	report(faultMotorLost)
+}
+
+// supervisedDriver reports every motor command to the motor supervisor.
+type supervisedDriver struct {
+	elevio.Driver
+	motor *motorSupervisor
+}
+
+func (d *supervisedDriver) SetMotorDirection(dir elevio.MotorDirection) {
+	d.motor.commanded(dir)
+	d.Driver.SetMotorDirection(dir)
+}
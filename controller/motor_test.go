@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"elevator/clock"
+	"elevator/elevio"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMotorSupervisor_DeclaresMissingArrival(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	faults := make(chan string, 1)
+	m := newMotorSupervisor(clk, 0)
+	m.supervise(2*time.Second, func(fault string) { faults <- fault })
+
+	m.commanded(elevio.MD_Up)
+	clk.Advance(2900 * time.Millisecond)
+	if m.isLost() {
+		t.Fatal("Expected the motor not to be lost before the timeout")
+	}
+
+	clk.Advance(200 * time.Millisecond)
+	select {
+	case fault := <-faults:
+		if fault != faultMotorLost {
+			t.Errorf("Expected the motor to be lost, was %q", fault)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the missing arrival to be reported")
+	}
+
+	if f := m.passed(1); !reflect.DeepEqual(f, []string{faultMotorRecovered}) || m.isLost() {
+		t.Errorf("Expected the motor to recover once the car arrived, was %v", f)
+	}
+}
+
+func TestMotorSupervisor_ChecksFloorSequence(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction elevio.MotorDirection
+		floors    []int
+		faults    []string
+	}{
+		{"next floors", elevio.MD_Up, []int{1, 2, 3}, nil},
+		{"skipped floor", elevio.MD_Up, []int{1, 3}, []string{faultFloorSkipped}},
+		{"wrong direction", elevio.MD_Down, []int{2}, []string{faultWrongDirection}},
+		{"wrong direction twice", elevio.MD_Down, []int{2, 3}, []string{faultWrongDirection}},
+		{"back in direction", elevio.MD_Down, []int{2, 1, 0}, []string{faultWrongDirection, faultMotorRecovered}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newMotorSupervisor(clock.NewFake(time.Now()), 1)
+			m.commanded(test.direction)
+
+			var faults []string
+			for _, floor := range test.floors {
+				faults = append(faults, m.passed(floor)...)
+			}
+			if !reflect.DeepEqual(faults, test.faults) {
+				t.Errorf("Expected faults %v, was %v", test.faults, faults)
+			}
+		})
+	}
+}
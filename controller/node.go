@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"elevator/api"
+	"elevator/chaos"
+	"elevator/clock"
+	"elevator/dashboard"
+	"elevator/elevio"
+	"elevator/transport"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config describes one elevator node. Zero values pick the defaults noted.
+type Config struct {
+	ID         int
+	DriverAddr string // address of the elevator server
+	Floors     int    // 4 if zero
+
+	APIAddr      string        // status and control API, disabled if empty
+	JournalPath  string        // journal of all events for replay, disabled if empty
+	CabCallCache string        // `DefaultCabCallCache` followed by `_<ID>` if empty
+	TravelTime   time.Duration // from one floor to the next, `DefaultTravelTime` if zero
+	Capacity     int           // passengers the car takes, 0 if unknown
+
+	// Transport to exchange states and assignments over, broadcasting over UDP if nil. Nodes in
+	// one process need a transport of their own each, e.g. a node of a `transport.Network`.
+	Transport transport.Transport
+
+	// Chaos allows injecting faults through the API. A kill calls `OnKill`, which exits the
+	// process if nil.
+	Chaos  bool
+	OnKill func()
+}
+
+// Node is one elevator with its connection to the elevator server, state sync, assigner,
+// controller and API. Several nodes can run in one process.
+type Node struct {
+	cfg Config
+
+	mtx      sync.Mutex
+	started  bool
+	api      api.Controller
+	stop     context.CancelFunc
+	finished chan struct{} // closed once the node stopped
+}
+
+// NewNode prepares the node described by `cfg`.
+func NewNode(cfg Config) *Node {
+	if cfg.Floors == 0 {
+		cfg.Floors = 4
+	}
+	if cfg.CabCallCache == "" {
+		cfg.CabCallCache = defaultCabCallCache(cfg.ID)
+	}
+	if cfg.TravelTime == 0 {
+		cfg.TravelTime = DefaultTravelTime
+	}
+	return &Node{cfg: cfg, finished: make(chan struct{})}
+}
+
+// Start connects to the elevator server, moves the car to the nearest floor and runs the elevator
+// in the background until `ctx` is done or `Stop` is called. Returns an error if the elevator
+// could not be started, also if `ctx` was done or `Stop` called before the car reached a floor.
+// The node is stopped then.
+func (n *Node) Start(ctx context.Context) error {
+	n.mtx.Lock()
+	if n.started {
+		n.mtx.Unlock()
+		return errors.New("node already started")
+	}
+	ctx, stop := context.WithCancel(ctx)
+	n.started = true
+	n.stop = stop
+	n.mtx.Unlock()
+
+	// Moving the car may take a while, so the node is not locked meanwhile and can be stopped
+	if err := n.start(ctx); err != nil {
+		stop()
+		close(n.finished)
+		return err
+	}
+	return nil
+}
+
+// Starts the node until `ctx` is done, see `Start`.
+func (n *Node) start(ctx context.Context) error {
+	cfg := n.cfg
+	hardware, err := elevio.Dial(cfg.DriverAddr, cfg.Floors, clock.Real{})
+	if err != nil {
+		return fmt.Errorf("connecting to the elevator at %s: %w", cfg.DriverAddr, err)
+	}
+	driver := chaos.NewDriver(hardware)
+	if err := moveToNearestFloor(ctx, driver, clock.Real{}); err != nil {
+		hardware.Close()
+		return fmt.Errorf("moving to the nearest floor: %w", err)
+	}
+
+	inputs := Inputs{
+		Buttons:     make(chan elevio.ButtonEvent),
+		Floors:      make(chan int),
+		Obstruction: make(chan bool),
+		Stop:        make(chan bool),
+	}
+	var base transport.Transport = transport.UDP{}
+	if cfg.Transport != nil {
+		base = cfg.Transport
+	}
+	tr := chaos.NewTransport(base, clock.Real{}, time.Now().UnixNano())
+	c := New(cfg.ID, cfg.Floors, driver, inputs, tr, clock.Real{})
+	c.SuperviseMotor(cfg.TravelTime)
+	c.SetCapacity(cfg.Capacity)
+	if cfg.CabCallCache == defaultCabCallCache(cfg.ID) {
+		migrateCabCallCache(DefaultCabCallCache, cfg.CabCallCache)
+	}
+	c.PersistCabCalls(cfg.CabCallCache)
+	if cfg.JournalPath != "" {
+		if c.elevator.journal, err = openJournal(cfg.JournalPath); err != nil {
+			_log.Error("opening journal failed, running without", "path", cfg.JournalPath, "err", err)
+		}
+	}
+
+	var faults *chaos.Node // nil unless faults can be injected
+	if cfg.APIAddr != "" {
+		ctl := c.API()
+		mux := api.NewHandler(ctl, cfg.Floors)
+		dashboard.Register(mux, ctl, cfg.Floors, clock.Real{})
+		if cfg.Chaos {
+			faults = c.ChaosNode(tr, driver, n.kill)
+			chaos.Register(mux, faults)
+		}
+		if err := api.Serve(ctx, cfg.APIAddr, mux); err != nil {
+			faults.Stop()
+			c.elevator.journal.close()
+			hardware.Close()
+			return fmt.Errorf("serving the API: %w", err)
+		}
+	}
+
+	// The hardware is only disconnected once polling stopped. Floors pass the chaos driver, which
+	// holds them back while it is disconnected.
+	floors := make(chan int)
+	var polling sync.WaitGroup
+	for _, poll := range []func(context.Context){
+		func(ctx context.Context) { hardware.PollButtons(ctx, inputs.Buttons) },
+		func(ctx context.Context) { hardware.PollFloorSensor(ctx, floors) },
+		func(ctx context.Context) { driver.GateFloors(ctx, floors, inputs.Floors) },
+		func(ctx context.Context) { hardware.PollObstructionSwitch(ctx, inputs.Obstruction) },
+		func(ctx context.Context) { hardware.PollStopButton(ctx, inputs.Stop) },
+	} {
+		polling.Add(1)
+		go func() {
+			defer polling.Done()
+			poll(ctx)
+		}()
+	}
+
+	go func() {
+		defer close(n.finished)
+		c.Run(ctx)
+		polling.Wait()
+		faults.Stop()
+		c.elevator.journal.close()
+		hardware.Close()
+	}()
+
+	n.mtx.Lock()
+	n.api = c.API()
+	n.mtx.Unlock()
+	return nil
+}
+
+// Stop shuts the node down in order and returns once it stopped, also aborting a `Start` in
+// progress. See `Controller.Run`.
+func (n *Node) Stop() {
+	n.mtx.Lock()
+	started, stop := n.started, n.stop
+	n.mtx.Unlock()
+
+	if !started {
+		return
+	}
+	stop()
+	<-n.finished
+}
+
+// Done returns a channel which is closed once the started node stopped.
+func (n *Node) Done() <-chan struct{} {
+	return n.finished
+}
+
+// API returns the status and control API of the started node, also if it is not served over HTTP.
+func (n *Node) API() api.Controller {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	return n.api
+}
+
+// Called when the node is killed by fault injection.
+func (n *Node) kill() {
+	_log.Error("killed by fault injection")
+	if n.cfg.OnKill != nil {
+		n.cfg.OnKill()
+		return
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	asg "elevator/assigner"
+	"elevator/elevio"
+	"elevator/transport"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// serveElevator runs an elevator server whose car stands at the ground floor with no buttons
+// pressed. Returns its address.
+func serveElevator(t *testing.T) string {
+	return serveElevatorAt(t, 0)
+}
+
+// serveElevatorAt runs an elevator server whose car stands at `floor`, or between floors if -1,
+// with no buttons pressed. The car never moves. Returns its address.
+func serveElevatorAt(t *testing.T, floor int) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var in [4]byte
+				for {
+					if _, err := io.ReadFull(conn, in[:]); err != nil {
+						return
+					}
+					switch in[0] {
+					case 6, 8, 9:
+						conn.Write([]byte{in[0], 0, 0, 0})
+					case 7:
+						if floor == -1 {
+							conn.Write([]byte{7, 0, 0, 0})
+						} else {
+							conn.Write([]byte{7, 1, byte(floor), 0})
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// waitForAlive waits until `node` sees exactly the elevators `ids` alive.
+func waitForAlive(t *testing.T, node *Node, ids []int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !reflect.DeepEqual(node.API().AliveElevatorIDs(), ids) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected alive elevators %v, was %v", ids, node.API().AliveElevatorIDs())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewNode_DerivesCabCallCacheFromID(t *testing.T) {
+	if path := NewNode(Config{ID: 2}).cfg.CabCallCache; path != ".cabcall_cache_2" {
+		t.Errorf("Expected the cab call cache of elevator 2 to default to .cabcall_cache_2, was %s", path)
+	}
+}
+
+func TestNode_RunsSeveralPerProcess(t *testing.T) {
+	network := transport.NewNetwork(transport.NetworkConfig{})
+	nodes := make([]*Node, 2)
+	for id := range nodes {
+		nodes[id] = NewNode(Config{
+			ID:           id,
+			DriverAddr:   serveElevator(t),
+			CabCallCache: filepath.Join(t.TempDir(), DefaultCabCallCache),
+			Transport:    network.Node(id),
+		})
+		if err := nodes[id].Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer nodes[id].Stop()
+	}
+
+	waitForAlive(t, nodes[0], []int{0, 1})
+	waitForAlive(t, nodes[1], []int{0, 1})
+
+	nodes[1].Stop()
+	select {
+	case <-nodes[1].Done():
+	default:
+		t.Fatal("Expected the node to be done once stopped")
+	}
+	waitForAlive(t, nodes[0], []int{0})
+}
+
+func TestNode_FailsToStartWithoutElevator(t *testing.T) {
+	node := NewNode(Config{DriverAddr: "127.0.0.1:1"})
+	if err := node.Start(context.Background()); err == nil {
+		t.Error("Expected an error connecting to a missing elevator server")
+	}
+	node.Stop()
+}
+
+func TestNode_StartReturnsOnceContextDoneBetweenFloors(t *testing.T) {
+	node := NewNode(Config{
+		DriverAddr:   serveElevatorAt(t, -1),
+		CabCallCache: filepath.Join(t.TempDir(), DefaultCabCallCache),
+		Transport:    transport.NewNetwork(transport.NetworkConfig{}).Node(0),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := node.Start(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected starting to fail once the context is done, was %v", err)
+	}
+	select {
+	case <-node.Done():
+	default:
+		t.Error("Expected the node to be done")
+	}
+}
+
+func TestNode_StopAbortsStartBetweenFloors(t *testing.T) {
+	node := NewNode(Config{
+		DriverAddr:   serveElevatorAt(t, -1),
+		CabCallCache: filepath.Join(t.TempDir(), DefaultCabCallCache),
+		Transport:    transport.NewNetwork(transport.NetworkConfig{}).Node(0),
+	})
+	started := make(chan error)
+	go func() { started <- node.Start(context.Background()) }()
+
+	time.Sleep(50 * time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		node.Stop()
+		close(stopped)
+	}()
+	select {
+	case err := <-started:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected starting to be aborted, was %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Stop to abort Start")
+	}
+	<-stopped
+}
+
+func TestNode_DropsAssignmentsOfFloorsItDoesNotHave(t *testing.T) {
+	network := transport.NewNetwork(transport.NetworkConfig{})
+	node := NewNode(Config{
+		DriverAddr:   serveElevator(t),
+		CabCallCache: filepath.Join(t.TempDir(), DefaultCabCallCache),
+		Transport:    network.Node(0),
+	})
+	if err := node.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer node.Stop()
+
+	conn, err := network.Node(9).Dial(asg.BroadcastPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Sent until taken, since the node may not be listening yet
+	calls := []elevio.ButtonEvent{
+		{Floor: 99, Button: elevio.BT_HallUp},
+		{Floor: 1, Button: elevio.BT_Cab},
+		{Floor: 2, Button: elevio.BT_HallUp},
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for !node.API().Status().Requests[2][elevio.BT_HallUp] {
+		for nonce, b := range calls {
+			conn.Write(asg.EncodeMessage(asg.Message{AssigneeID: 0, AssignerID: 9, Button: b, Nonce: nonce}))
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the hall call at floor 2 to be taken")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if node.API().Status().Requests[1][elevio.BT_Cab] {
+		t.Error("Expected the cab call assigned over the network to be dropped")
+	}
+	select {
+	case <-node.Done():
+		t.Error("Expected the node to keep running")
+	default:
+	}
+}
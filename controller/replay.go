@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"elevator/api"
+	"elevator/clock"
+	"elevator/elevio"
+	sts "elevator/statesync"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Time to wait for door cycles started by the last event of a replay.
+const replaySettleTime = 2 * doorOpenDelay
+
+// Replay feeds the events of a journaled `run` into a controller driving a fake elevator. The
+// controller runs on a fake clock advanced to the time every event was recorded at, since door
+// cycles are timed, so a replay takes a fraction of the recorded run. Everything runs in the
+// calling goroutine, so replays are deterministic. Events and the resulting driver outputs are
+// written to `out` in order.
+func Replay(run []Event, out io.Writer) error {
+	if len(run) == 0 || run[0].Kind != EV_Start || run[0].Floor == nil {
+		return fmt.Errorf("run does not begin with a start event")
+	}
+	start := run[0]
+	if *start.Floor < 0 || *start.Floor >= len(start.Requests) {
+		return fmt.Errorf("start floor %d out of range", *start.Floor)
+	}
+
+	clk := clock.NewFake(start.Time)
+	driver := &replayDriver{out: out, clock: clk, startedAt: start.Time, floor: *start.Floor}
+	driver.print("<", start.String())
+
+	e := newElevator(start.ElevatorID, driver, clk, *start.Floor, start.Requests)
+	// The availability is recorded by a state sync which is never started, so nothing is sent
+	e.sync = sts.New(e, nil, clk, nil, nil, nil)
+	e.start()
+
+	for i, ev := range run[1:] {
+		if ev.Kind.IsOutput() || ev.Kind == EV_NearestFloor {
+			continue
+		}
+		advanceTo(e, clk, ev.Time)
+		if ev.Kind == EV_Floor {
+			driver.setFloor(*ev.Floor)
+		}
+		driver.expectNearestFloors(nearestFloorsAfter(run[i+2:]))
+		driver.print("<", ev.String())
+		e.handle(context.Background(), ev)
+	}
+
+	// Timers still pending afterwards never fire, as nothing advances the clock any more
+	advanceTo(e, clk, clk.Now().Add(replaySettleTime))
+	return nil
+}
+
+// Advances `clk` to `t` one timer at a time and handles the timeouts of `e` after each, as its
+// main event loop would.
+func advanceTo(e *elevator, clk *clock.Fake, t time.Time) {
+	e.handleTimeouts(context.Background())
+	for clk.Step(t) {
+		e.handleTimeouts(context.Background())
+	}
+	clk.Advance(t.Sub(clk.Now()))
+}
+
+// Returns the floors reached by moving to the nearest floor while handling the input before `run`.
+func nearestFloorsAfter(run []Event) []int {
+	var floors []int
+	for _, ev := range run {
+		if ev.Kind == EV_NearestFloor {
+			floors = append(floors, *ev.Floor)
+		} else if !ev.Kind.IsOutput() {
+			break
+		}
+	}
+	return floors
+}
+
+// replayDriver prints every output of the controller and reports the last floor replayed. While
+// floors reached by moving to the nearest floor are pending, the car is between floors until it
+// is moved up, and then reaches the first of them.
+type replayDriver struct {
+	mtx       sync.Mutex
+	out       io.Writer
+	clock     clock.Clock
+	startedAt time.Time
+	floor     int
+	nearest   []int // pending floors reached by moving to the nearest floor
+	between   bool  // reported being between floors since the last one was reached
+	arriving  bool  // moved up since, so the car reaches the next pending floor
+}
+
+func (d *replayDriver) print(direction string, line string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	fmt.Fprintf(d.out, "%9s %s %s\n", "+"+d.clock.Since(d.startedAt).Round(time.Millisecond).String(), direction, line)
+}
+
+func (d *replayDriver) setFloor(floor int) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.floor = floor
+}
+
+// The car reaches `floors` in order by moving to the nearest floor while the next input is handled.
+func (d *replayDriver) expectNearestFloors(floors []int) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.nearest, d.between, d.arriving = floors, false, false
+}
+
+func (d *replayDriver) SetMotorDirection(dir elevio.MotorDirection) {
+	d.print(">", "motor "+api.DirectionName(dir))
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if dir == elevio.MD_Up && d.between {
+		d.arriving = true
+	}
+}
+
+func (d *replayDriver) SetButtonLamp(button elevio.ButtonType, floor int, value bool) {
+	d.print(">", fmt.Sprintf("button lamp floor=%d button=%d %v", floor, button, value))
+}
+
+func (d *replayDriver) SetFloorIndicator(floor int) {
+	d.print(">", fmt.Sprintf("floor indicator %d", floor))
+}
+
+func (d *replayDriver) SetDoorOpenLamp(value bool) {
+	d.print(">", fmt.Sprintf("door open lamp %v", value))
+}
+
+func (d *replayDriver) GetFloor() int {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.arriving {
+		d.floor, d.nearest = d.nearest[0], d.nearest[1:]
+		d.between, d.arriving = false, false
+	} else if len(d.nearest) > 0 {
+		d.between = true
+		return -1
+	}
+	return d.floor
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"elevator/elevio"
+	"sync"
+	"time"
+)
+
+type timeoutKind int
+
+const (
+	TO_OppositeCalls timeoutKind = 0 // the door was open long enough for the calls in the direction of travel
+	TO_CloseDoor     timeoutKind = 1 // the door was open long enough for all calls at the floor
+	TO_MotorFault    timeoutKind = 2 // the motor supervisor detected a fault
+)
+
+// timeout is a timer of the elevator which ran out.
+type timeout struct {
+	kind      timeoutKind
+	direction elevio.MotorDirection // the car arrived in, for door timeouts
+	fault     string                // for TO_MotorFault
+}
+
+// timeoutQueue hands timers which ran out on the goroutine of the clock over to the main event
+// loop, so the elevator is only ever changed from there. Pushing never blocks, so timers may run
+// out while the loop is busy, frozen or stopped.
+type timeoutQueue struct {
+	mtx     sync.Mutex
+	expired []timeout
+	ready   chan struct{} // signalled whenever timeouts are pending, unless a signal is pending anyway
+}
+
+func newTimeoutQueue() *timeoutQueue {
+	return &timeoutQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *timeoutQueue) push(t timeout) {
+	q.mtx.Lock()
+	q.expired = append(q.expired, t)
+	q.mtx.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Returns and removes all pending timeouts, in the order they ran out.
+func (q *timeoutQueue) take() []timeout {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	expired := q.expired
+	q.expired = nil
+	return expired
+}
+
+// Pushes `t` once `d` passed.
+func (e *elevator) after(d time.Duration, t timeout) {
+	e.clock.AfterFunc(d, func() { e.timeouts.push(t) })
+}
+
+// Reports the fault `description` of the motor supervisor to the main event loop.
+func (e *elevator) reportMotorFault(description string) {
+	e.timeouts.push(timeout{kind: TO_MotorFault, fault: description})
+}
+
+// Handles all pending timeouts until `ctx` is done. Must be called from the main event loop.
+func (e *elevator) handleTimeouts(ctx context.Context) {
+	for _, t := range e.timeouts.take() {
+		switch t.kind {
+		case TO_OppositeCalls:
+			e.clearOppositeDirectionRequests(t.direction)
+		case TO_CloseDoor:
+			e.closeDoor(t.direction)
+		case TO_MotorFault:
+			e.process(ctx, Event{Kind: EV_Fault, Fault: t.fault})
+		}
+		e.publish()
+	}
+}
@@ -0,0 +1,92 @@
+package dashboard
+
+import (
+	"elevator/api"
+	"elevator/clock"
+	"elevator/elevio"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+const refreshInterval = 200 * time.Millisecond
+
+//go:embed static
+var static embed.FS
+
+// Building is everything the dashboard renders at one instant.
+type Building struct {
+	NumFloors int              `json:"numFloors"`
+	Time      time.Time        `json:"time"`
+	HallLamps [][2]bool        `json:"hallLamps"`
+	Elevators []api.PeerStatus `json:"elevators"`
+}
+
+// Register adds the dashboard page at `/dashboard/` and its server-sent event stream
+// at `/dashboard/events` to `mux`. Elevators are rendered from statesync data, completed
+// with the local state of `ctl` and timed by `clk`.
+func Register(mux *http.ServeMux, ctl api.Controller, numFloors int, clk clock.Clock) {
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServerFS(mustSub(static, "static"))))
+
+	mux.HandleFunc("GET /dashboard/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		ticker := clk.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			data, err := json.Marshal(snapshot(numFloors, clk.Now(), ctl.Status(), ctl.Peers()))
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	})
+}
+
+// Builds the building at `now` from the states of all `elevators` and the state of the `local` elevator.
+// A hall lamp is lit if any alive elevator holds the hall call.
+func snapshot(numFloors int, now time.Time, local api.ElevatorStatus, elevators []api.PeerStatus) Building {
+	building := Building{
+		NumFloors: numFloors,
+		Time:      now,
+		HallLamps: make([][2]bool, numFloors),
+		Elevators: elevators,
+	}
+	for i, e := range elevators {
+		if e.ID == local.ID {
+			elevators[i].Behaviour = local.Behaviour
+		}
+		if e.Status == "left" {
+			continue
+		}
+		for floor := 0; floor < numFloors && floor < len(e.Requests); floor++ {
+			building.HallLamps[floor][elevio.BT_HallUp] = building.HallLamps[floor][elevio.BT_HallUp] || e.Requests[floor][elevio.BT_HallUp]
+			building.HallLamps[floor][elevio.BT_HallDown] = building.HallLamps[floor][elevio.BT_HallDown] || e.Requests[floor][elevio.BT_HallDown]
+		}
+	}
+	return building
+}
+
+func mustSub(fsys embed.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,45 @@
+package dashboard
+
+import (
+	"elevator/api"
+	"elevator/clock"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard_HallLampsOfAliveElevators(t *testing.T) {
+	elevators := []api.PeerStatus{
+		{ID: 0, Status: "alive", Requests: [][3]bool{{true, false, false}, {false, false, true}, {false, false, false}}},
+		{ID: 1, Status: "suspect", Requests: [][3]bool{{false, false, false}, {false, true, false}, {false, false, false}}},
+		{ID: 2, Status: "left", Requests: [][3]bool{{false, false, false}, {false, false, false}, {false, true, false}}},
+	}
+
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	building := snapshot(3, now, api.ElevatorStatus{ID: 1, Behaviour: "door_open"}, elevators)
+
+	expected := [][2]bool{{true, false}, {false, true}, {false, false}}
+	if !reflect.DeepEqual(building.HallLamps, expected) {
+		t.Errorf("Hall lamps not as expected.\nExpected: %+v\nWas: %+v", expected, building.HallLamps)
+	}
+	if !building.Time.Equal(now) {
+		t.Errorf("Expected the building at %v, was %v", now, building.Time)
+	}
+	if building.Elevators[1].Behaviour != "door_open" || building.Elevators[0].Behaviour != "" {
+		t.Errorf("Expected behaviour only for the local elevator, was %+v", building.Elevators)
+	}
+}
+
+func TestDashboard_ServesPage(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, nil, 4, clock.Real{})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dashboard/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "EventSource") {
+		t.Errorf("Expected dashboard page, was %d", rec.Code)
+	}
+}
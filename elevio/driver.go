@@ -0,0 +1,11 @@
+package elevio
+
+// Driver is the output side of the elevator hardware as used by the controller, so the controller
+// can also be run against a fake elevator. It is implemented by `Hardware`.
+type Driver interface {
+	SetMotorDirection(dir MotorDirection)
+	SetButtonLamp(button ButtonType, floor int, value bool)
+	SetFloorIndicator(floor int)
+	SetDoorOpenLamp(value bool)
+	GetFloor() int
+}
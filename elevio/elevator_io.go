@@ -1,7 +1,9 @@
 package elevio
 
 import (
-	"fmt"
+	"context"
+	"elevator/clock"
+	"elevator/logging"
 	"net"
 	"sync"
 	"time"
@@ -9,10 +11,7 @@ import (
 
 const _pollRate = 20 * time.Millisecond
 
-var _initialized bool = false
-var _numFloors int = 4
-var _mtx sync.Mutex
-var _conn net.Conn
+var _log = logging.For("elevio")
 
 type MotorDirection int
 
@@ -35,50 +34,63 @@ type ButtonEvent struct {
 	Button ButtonType
 }
 
-func Init(addr string, numFloors int) {
-	if _initialized {
-		fmt.Println("Driver already initialized!")
-		return
-	}
-	_numFloors = numFloors
-	_mtx = sync.Mutex{}
-	var err error
-	_conn, err = net.Dial("tcp", addr)
+// Hardware is the connection to one elevator server. Every elevator of a process has its own.
+type Hardware struct {
+	mtx       sync.Mutex
+	conn      net.Conn
+	numFloors int
+	clock     clock.Clock
+}
+
+// Dial connects to the elevator server at `addr` of an elevator with `numFloors`. The Poll
+// methods are timed by `clk`.
+func Dial(addr string, numFloors int, clk clock.Clock) (*Hardware, error) {
+	conn, err := net.Dial("tcp", addr)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
-	_initialized = true
+	_log.Debug("connected to elevator server", "addr", addr)
+	return &Hardware{conn: conn, numFloors: numFloors, clock: clk}, nil
+}
+
+// Close disconnects from the elevator server. The Poll methods must have returned.
+func (h *Hardware) Close() error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	return h.conn.Close()
 }
 
-func SetMotorDirection(dir MotorDirection) {
-	write([4]byte{1, byte(dir), 0, 0})
+func (h *Hardware) SetMotorDirection(dir MotorDirection) {
+	h.write([4]byte{1, byte(dir), 0, 0})
 }
 
-func SetButtonLamp(button ButtonType, floor int, value bool) {
-	write([4]byte{2, byte(button), byte(floor), toByte(value)})
+func (h *Hardware) SetButtonLamp(button ButtonType, floor int, value bool) {
+	h.write([4]byte{2, byte(button), byte(floor), toByte(value)})
 }
 
-func SetFloorIndicator(floor int) {
-	write([4]byte{3, byte(floor), 0, 0})
+func (h *Hardware) SetFloorIndicator(floor int) {
+	h.write([4]byte{3, byte(floor), 0, 0})
 }
 
-func SetDoorOpenLamp(value bool) {
-	write([4]byte{4, toByte(value), 0, 0})
+func (h *Hardware) SetDoorOpenLamp(value bool) {
+	h.write([4]byte{4, toByte(value), 0, 0})
 }
 
-func SetStopLamp(value bool) {
-	write([4]byte{5, toByte(value), 0, 0})
+func (h *Hardware) SetStopLamp(value bool) {
+	h.write([4]byte{5, toByte(value), 0, 0})
 }
 
-func PollButtons(receiver chan<- ButtonEvent) {
-	prev := make([][3]bool, _numFloors)
-	for {
-		time.Sleep(_pollRate)
-		for f := 0; f < _numFloors; f++ {
+// The Poll methods send every change of an input on `receiver` until `ctx` is done.
+
+func (h *Hardware) PollButtons(ctx context.Context, receiver chan<- ButtonEvent) {
+	prev := make([][3]bool, h.numFloors)
+	for h.sleep(ctx) {
+		for f := 0; f < h.numFloors; f++ {
 			for b := ButtonType(0); b < 3; b++ {
-				v := GetButton(b, f)
-				if v != prev[f][b] && v != false {
-					receiver <- ButtonEvent{f, ButtonType(b)}
+				v := h.GetButton(b, f)
+				if v != prev[f][b] && v != false && !send(ctx, receiver, ButtonEvent{f, ButtonType(b)}) {
+					return
 				}
 				prev[f][b] = v
 			}
@@ -86,49 +98,62 @@ func PollButtons(receiver chan<- ButtonEvent) {
 	}
 }
 
-func PollFloorSensor(receiver chan<- int) {
-	prev := GetFloor()
-	for {
-		time.Sleep(_pollRate)
-		v := GetFloor()
-		if v != prev && v != -1 {
-			receiver <- v
+func (h *Hardware) PollFloorSensor(ctx context.Context, receiver chan<- int) {
+	prev := h.GetFloor()
+	for h.sleep(ctx) {
+		v := h.GetFloor()
+		if v != prev && v != -1 && !send(ctx, receiver, v) {
+			return
 		}
 		prev = v
 	}
 }
 
-func PollStopButton(receiver chan<- bool) {
+func (h *Hardware) PollStopButton(ctx context.Context, receiver chan<- bool) {
 	prev := false
-	for {
-		time.Sleep(_pollRate)
-		v := GetStop()
-		if v != prev {
-			receiver <- v
+	for h.sleep(ctx) {
+		v := h.GetStop()
+		if v != prev && !send(ctx, receiver, v) {
+			return
 		}
 		prev = v
 	}
 }
 
-func PollObstructionSwitch(receiver chan<- bool) {
+func (h *Hardware) PollObstructionSwitch(ctx context.Context, receiver chan<- bool) {
 	prev := false
-	for {
-		time.Sleep(_pollRate)
-		v := GetObstruction()
-		if v != prev {
-			receiver <- v
+	for h.sleep(ctx) {
+		v := h.GetObstruction()
+		if v != prev && !send(ctx, receiver, v) {
+			return
 		}
 		prev = v
 	}
 }
 
-func GetButton(button ButtonType, floor int) bool {
-	a := read([4]byte{6, byte(button), byte(floor), 0})
+// Waits for the next poll. Reports false once `ctx` is done.
+func (h *Hardware) sleep(ctx context.Context) bool {
+	h.clock.Sleep(_pollRate)
+	return ctx.Err() == nil
+}
+
+// Sends `v` on `receiver`. Reports false if `ctx` was done before it was received.
+func send[T any](ctx context.Context, receiver chan<- T, v T) bool {
+	select {
+	case receiver <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (h *Hardware) GetButton(button ButtonType, floor int) bool {
+	a := h.read([4]byte{6, byte(button), byte(floor), 0})
 	return toBool(a[1])
 }
 
-func GetFloor() int {
-	a := read([4]byte{7, 0, 0, 0})
+func (h *Hardware) GetFloor() int {
+	a := h.read([4]byte{7, 0, 0, 0})
 	if a[1] != 0 {
 		return int(a[2])
 	} else {
@@ -136,27 +161,27 @@ func GetFloor() int {
 	}
 }
 
-func GetStop() bool {
-	a := read([4]byte{8, 0, 0, 0})
+func (h *Hardware) GetStop() bool {
+	a := h.read([4]byte{8, 0, 0, 0})
 	return toBool(a[1])
 }
 
-func GetObstruction() bool {
-	a := read([4]byte{9, 0, 0, 0})
+func (h *Hardware) GetObstruction() bool {
+	a := h.read([4]byte{9, 0, 0, 0})
 	return toBool(a[1])
 }
 
-func read(in [4]byte) [4]byte {
-	_mtx.Lock()
-	defer _mtx.Unlock()
+func (h *Hardware) read(in [4]byte) [4]byte {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
 
-	_, err := _conn.Write(in[:])
+	_, err := h.conn.Write(in[:])
 	if err != nil {
 		panic("Lost connection to Elevator Server")
 	}
 
 	var out [4]byte
-	_, err = _conn.Read(out[:])
+	_, err = h.conn.Read(out[:])
 	if err != nil {
 		panic("Lost connection to Elevator Server")
 	}
@@ -164,11 +189,11 @@ func read(in [4]byte) [4]byte {
 	return out
 }
 
-func write(in [4]byte) {
-	_mtx.Lock()
-	defer _mtx.Unlock()
+func (h *Hardware) write(in [4]byte) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
 
-	_, err := _conn.Write(in[:])
+	_, err := h.conn.Write(in[:])
 	if err != nil {
 		panic("Lost connection to Elevator Server")
 	}
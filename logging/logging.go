@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Every package gets its logger with `For(subsystem)` as a package level variable. Loggers can be
+// created before `Configure` is called; records always go to the handler configured last.
+
+// DefaultRateLimit is the minimum interval between repetitions of a message unless set otherwise.
+const DefaultRateLimit = 1 * time.Second
+
+const maxLimiterKeys = 1000
+
+var _root atomic.Pointer[slog.Handler]
+var _mtx sync.Mutex
+var _defaultLevel = new(slog.LevelVar)
+var _levels = make(map[string]*slog.LevelVar)
+var _rateLimit atomic.Int64
+
+func init() {
+	Configure(os.Stderr, -1, false)
+	_rateLimit.Store(int64(DefaultRateLimit))
+}
+
+// Configure sends all records to `w` as text, or as JSON if `json` is set. Every record carries
+// the ID of the elevator unless `elevatorID` is negative.
+func Configure(w io.Writer, elevatorID int, json bool) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	if json {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	if elevatorID >= 0 {
+		h = h.WithAttrs([]slog.Attr{slog.Int("elevator", elevatorID)})
+	}
+	_root.Store(&h)
+}
+
+// For returns the logger of `subsystem`.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{
+		subsystem: subsystem,
+		level:     subsystemLevel(subsystem),
+		limiter:   &limiter{last: make(map[string]time.Time), suppressed: make(map[string]int)},
+	})
+}
+
+// SetLevel sets the minimum level of `subsystem` at runtime. An empty subsystem sets the level of
+// all subsystems without an explicit level.
+func SetLevel(subsystem string, level slog.Level) {
+	if subsystem == "" {
+		_defaultLevel.Set(level)
+		return
+	}
+	_mtx.Lock()
+	defer _mtx.Unlock()
+
+	if _, exists := _levels[subsystem]; !exists {
+		_levels[subsystem] = new(slog.LevelVar)
+	}
+	_levels[subsystem].Set(level)
+}
+
+// SetRateLimit drops repetitions of the same message with the same attributes of a subsystem within `interval`.
+// The number of dropped repetitions is attached to the next record passing. Zero disables it.
+func SetRateLimit(interval time.Duration) {
+	_rateLimit.Store(int64(interval))
+}
+
+// ParseLevels applies levels given as comma separated `subsystem=level` pairs, where a pair
+// without subsystem sets the default, e.g. `info,statesync=debug`.
+func ParseLevels(spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		subsystem, levelName, found := strings.Cut(pair, "=")
+		if !found {
+			subsystem, levelName = "", pair
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(levelName))); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", pair, err)
+		}
+		SetLevel(strings.TrimSpace(subsystem), level)
+	}
+	return nil
+}
+
+// subsystemLevel follows the default level until the level of the subsystem is set explicitly.
+type subsystemLevel string
+
+func (s subsystemLevel) Level() slog.Level {
+	_mtx.Lock()
+	level, exists := _levels[string(s)]
+	_mtx.Unlock()
+
+	if exists {
+		return level.Level()
+	}
+	return _defaultLevel.Level()
+}
+
+// subsystemHandler filters records by the level of its subsystem, rate limits them and
+// forwards them to the configured root handler.
+type subsystemHandler struct {
+	subsystem string
+	level     slog.Leveler
+	limiter   *limiter
+	attrs     []slog.Attr
+	groups    []string
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	suppressed, allowed := h.limiter.allow(recordKey(r), r.Time, time.Duration(_rateLimit.Load()))
+	if !allowed {
+		return nil
+	}
+	if suppressed > 0 {
+		r.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+
+	root := (*_root.Load()).WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	if len(h.attrs) > 0 {
+		root = root.WithAttrs(h.attrs)
+	}
+	for _, group := range h.groups {
+		root = root.WithGroup(group)
+	}
+	return root.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &clone
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.groups = append(append([]string(nil), h.groups...), name)
+	return &clone
+}
+
+// Identifies repetitions of a record by its message and attributes.
+func recordKey(r slog.Record) string {
+	var key strings.Builder
+	key.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		key.WriteString(" " + a.String())
+		return true
+	})
+	return key.String()
+}
+
+// limiter lets each message pass at most once per interval and counts the suppressed repetitions.
+type limiter struct {
+	mtx        sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+}
+
+func (l *limiter) allow(msg string, now time.Time, interval time.Duration) (suppressed int, allowed bool) {
+	if interval <= 0 {
+		return 0, true
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if last, exists := l.last[msg]; exists && now.Sub(last) < interval {
+		l.suppressed[msg]++
+		return 0, false
+	}
+	suppressed = l.suppressed[msg]
+	l.last[msg] = now
+	delete(l.suppressed, msg)
+
+	// Forget messages which passed long ago, attributes like durations make most keys unique
+	if len(l.last) > maxLimiterKeys {
+		for key, last := range l.last {
+			if now.Sub(last) >= interval && l.suppressed[key] == 0 {
+				delete(l.last, key)
+			}
+		}
+	}
+	return suppressed, true
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogging_LevelsPerSubsystem(t *testing.T) {
+	var out strings.Builder
+	Configure(&out, 3, false)
+	defer Configure(os.Stderr, -1, false)
+	if err := ParseLevels("warn,test-verbose=debug"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLevel("", slog.LevelInfo)
+
+	For("test-quiet").Info("quiet info")
+	For("test-quiet").Warn("quiet warning")
+	For("test-verbose").Debug("verbose debug")
+
+	if strings.Contains(out.String(), "quiet info") {
+		t.Errorf("Expected info of quiet subsystem to be dropped:\n%s", out.String())
+	}
+	for _, expected := range []string{"msg=\"quiet warning\"", "msg=\"verbose debug\"", "subsystem=test-verbose", "elevator=3"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, out.String())
+		}
+	}
+
+	if err := ParseLevels("test-verbose=loud"); err == nil {
+		t.Errorf("Expected unknown level to be rejected")
+	}
+}
+
+func TestLogging_JSON(t *testing.T) {
+	var out strings.Builder
+	Configure(&out, 1, true)
+	defer Configure(os.Stderr, -1, false)
+
+	For("test-json").With("peer", 2).Info("elevator failed")
+
+	var record map[string]any
+	if err := json.Unmarshal([]byte(out.String()), &record); err != nil {
+		t.Fatalf("Expected JSON record, got %q: %v", out.String(), err)
+	}
+	if record["subsystem"] != "test-json" || record["elevator"] != 1.0 || record["peer"] != 2.0 || record["msg"] != "elevator failed" {
+		t.Errorf("Record not as expected: %v", record)
+	}
+}
+
+func TestLogging_RateLimit(t *testing.T) {
+	l := &limiter{last: make(map[string]time.Time), suppressed: make(map[string]int)}
+	start := time.Now()
+
+	if _, allowed := l.allow("alive", start, time.Second); !allowed {
+		t.Errorf("Expected first message to pass")
+	}
+	for i := range 5 {
+		if _, allowed := l.allow("alive", start.Add(time.Duration(i)*100*time.Millisecond), time.Second); allowed {
+			t.Errorf("Expected repetition %d to be suppressed", i)
+		}
+	}
+	if _, allowed := l.allow("other", start, time.Second); !allowed {
+		t.Errorf("Expected a different message to pass")
+	}
+	if suppressed, allowed := l.allow("alive", start.Add(time.Second), time.Second); !allowed || suppressed != 5 {
+		t.Errorf("Expected message to pass after the interval with 5 suppressed, was %v %d", allowed, suppressed)
+	}
+}
+
+func TestLogging_RateLimitByAttributes(t *testing.T) {
+	var out strings.Builder
+	Configure(&out, -1, false)
+	defer Configure(os.Stderr, -1, false)
+
+	log := For("test-rate")
+	log.Info("button pressed", "floor", 1)
+	log.Info("button pressed", "floor", 1)
+	log.Info("button pressed", "floor", 2)
+
+	if n := strings.Count(out.String(), "button pressed"); n != 2 {
+		t.Errorf("Expected the repetition only to be dropped, was %d records:\n%s", n, out.String())
+	}
+}
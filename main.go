@@ -1,14 +1,63 @@
 package main
 
 import (
+	"context"
 	"elevator/controller"
+	"elevator/logging"
 	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Exit codes
+const (
+	exitOK           = 0 // shut down on signal
+	exitFailed       = 1 // the elevator could not be started
+	exitInvalidUsage = 2 // invalid flags
 )
 
 func main() {
 	idPtr := flag.Int("id", 0, "unique identifier of elevator")
 	addrPtr := flag.String("addr", "localhost:15657", "Address of elevator hardware")
+	apiAddrPtr := flag.String("api", "", "Address of the HTTP status and control API, e.g. :8080 (disabled if empty)")
+	journalPtr := flag.String("journal", "", "Append every event of the control loop to this file for replay (disabled if empty)")
+	travelTimePtr := flag.Duration("travel-time", controller.DefaultTravelTime, "Time the car takes from one floor to the next, the motor is declared lost if it takes much longer")
+	capacityPtr := flag.Int("capacity", 0, "Number of passengers the car takes, advertised to other elevators (0 if unknown)")
+	chaosPtr := flag.Bool("chaos", false, "Allow injecting faults through the API, e.g. killing this process")
+	logLevelPtr := flag.String("log-level", "info", "Log levels as `subsystem=level` pairs, e.g. info,statesync=debug")
+	logJSONPtr := flag.Bool("log-json", false, "Log as JSON instead of text")
+	logRateLimitPtr := flag.Duration("log-rate-limit", logging.DefaultRateLimit, "Minimum interval between repetitions of a log message (0 disables)")
 	flag.Parse()
 
-	controller.StartControlLoop(*idPtr, *addrPtr, 4)
+	logging.Configure(os.Stderr, *idPtr, *logJSONPtr)
+	logging.SetRateLimit(*logRateLimitPtr)
+	if err := logging.ParseLevels(*logLevelPtr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitInvalidUsage)
+	}
+
+	// The elevator shuts down in order on the first signal, a second one kills it right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	node := controller.NewNode(controller.Config{
+		ID:          *idPtr,
+		DriverAddr:  *addrPtr,
+		APIAddr:     *apiAddrPtr,
+		JournalPath: *journalPtr,
+		TravelTime:  *travelTimePtr,
+		Capacity:    *capacityPtr,
+		Chaos:       *chaosPtr,
+	})
+	if err := node.Start(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailed)
+	}
+	<-node.Done()
+	os.Exit(exitOK)
 }
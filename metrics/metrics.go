@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics are exported in the Prometheus text exposition format. Each package declares its metrics
+// in its metrics.go, series of the same name only differ in their constant labels. Registering a
+// series again returns the existing one, so a restarted component continues its series.
+
+var _mtx sync.Mutex
+var _families = make(map[string]*family)
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	metrics []metric
+	series  map[string]metric // by formatted labels
+}
+
+type metric interface {
+	write(w io.Writer, name string)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	mtx    sync.Mutex
+	labels string
+	value  float64
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	mtx     sync.Mutex
+	labels  []string
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewCounter registers a counter called `name`. `labels` are alternating label names and values.
+// Returns the counter registered before if there is one of the same name and labels.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{labels: formatLabels(labels)}
+	return register(name, help, "counter", c.labels, c).(*Counter)
+}
+
+// NewHistogram registers a histogram called `name` with the upper bounds `buckets` in increasing
+// order. `labels` are alternating label names and values. Returns the histogram registered
+// before if there is one of the same name and labels.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{labels: labels, buckets: buckets, counts: make([]uint64, len(buckets))}
+	return register(name, help, "histogram", formatLabels(labels), h).(*Histogram)
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increments the counter by `v`, which must not be negative.
+func (c *Counter) Add(v float64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.value += v
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.value
+}
+
+// Observe records the observation `v`.
+func (h *Histogram) Observe(v float64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	return h.count
+}
+
+// Handler serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+}
+
+// Write writes all registered metrics in the text exposition format.
+func Write(w io.Writer) {
+	_mtx.Lock()
+	defer _mtx.Unlock()
+
+	names := make([]string, 0, len(_families))
+	for name := range _families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := _families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+		for _, m := range f.metrics {
+			m.write(w, f.name)
+		}
+	}
+}
+
+// Registers `m` as the series of `name` with the formatted `labels`, unless there is one already,
+// and returns the series registered.
+func register(name, help, kind, labels string, m metric) metric {
+	_mtx.Lock()
+	defer _mtx.Unlock()
+
+	f, exists := _families[name]
+	if !exists {
+		f = &family{name: name, help: help, kind: kind, series: make(map[string]metric)}
+		_families[name] = f
+	}
+	if f.kind != kind {
+		panic(fmt.Sprintf("metric %s registered as %s and %s", name, f.kind, kind))
+	}
+	if registered, exists := f.series[labels]; exists {
+		return registered
+	}
+	f.series[labels] = m
+	f.metrics = append(f.metrics, m)
+	return m
+}
+
+func (c *Counter) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s%s %s\n", name, c.labels, formatValue(c.Value()))
+}
+
+func (h *Histogram) write(w io.Writer, name string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for i, bound := range h.buckets {
+		labels := formatLabels(append(append([]string(nil), h.labels...), "le", formatValue(bound)))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(append(append([]string(nil), h.labels...), "le", "+Inf")), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(h.labels), formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(h.labels), h.count)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetrics_TextExposition(t *testing.T) {
+	sent := NewCounter("test_messages_total", "Messages.", "type", "heartbeat")
+	NewCounter("test_messages_total", "Messages.", "type", "state").Add(2)
+	wait := NewHistogram("test_wait_seconds", "Wait time.", []float64{1, 5})
+
+	sent.Inc()
+	wait.Observe(0.5)
+	wait.Observe(3)
+	wait.Observe(10)
+
+	var out strings.Builder
+	Write(&out)
+
+	expected := []string{
+		"# TYPE test_messages_total counter",
+		`test_messages_total{type="heartbeat"} 1`,
+		`test_messages_total{type="state"} 2`,
+		"# TYPE test_wait_seconds histogram",
+		`test_wait_seconds_bucket{le="1"} 1`,
+		`test_wait_seconds_bucket{le="5"} 2`,
+		`test_wait_seconds_bucket{le="+Inf"} 3`,
+		"test_wait_seconds_sum 13.5",
+		"test_wait_seconds_count 3",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Expected line %q in output:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestMetrics_RegisteringSeriesAgainReturnsIt(t *testing.T) {
+	first := NewCounter("test_restarts_total", "Restarts.", "elevator", "0")
+	first.Inc()
+	other := NewCounter("test_restarts_total", "Restarts.", "elevator", "1")
+
+	if again := NewCounter("test_restarts_total", "Restarts.", "elevator", "0"); again != first {
+		t.Error("Expected the counter of elevator 0 to be returned again")
+	}
+	if other == first {
+		t.Error("Expected elevator 1 to get a counter of its own")
+	}
+
+	var out strings.Builder
+	Write(&out)
+	if n := strings.Count(out.String(), `test_restarts_total{elevator="0"}`); n != 1 {
+		t.Errorf("Expected the counter of elevator 0 to be written once, was %d times:\n%s", n, out.String())
+	}
+}
@@ -0,0 +1,74 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// WriteText writes `r` as tables for humans.
+func (r Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\tcalls\tmean\tp50\tp90\tp95\tp99\tmax\tunserved\t\n")
+	fmt.Fprintf(tw, "wait [s]\t%s%d\t\n", statsColumns(r.Wait), r.UnservedHall)
+	fmt.Fprintf(tw, "journey [s]\t%s%d\t\n", statsColumns(r.Journey), r.UnservedCab)
+
+	fmt.Fprintf(tw, "\n\televator\thall calls\tcab calls\tstops\tfloors\treversals\tmean wait\tp95 wait\t\n")
+	for _, e := range r.Elevators {
+		fmt.Fprintf(tw, "\t%d\t%d\t%d\t%d\t%d\t%d\t%.1f\t%.1f\t\n",
+			e.ID, e.HallCallsServed, e.CabCallsServed, e.Stops, e.FloorsTravelled, e.Reversals, e.Wait.Mean, e.Wait.P95)
+	}
+
+	fmt.Fprintf(tw, "\n\tfloor\thall calls\tmean wait\tp95 wait\tmax wait\t\n")
+	for _, f := range r.Floors {
+		fmt.Fprintf(tw, "\t%d\t%d\t%.1f\t%.1f\t%.1f\t\n", f.Floor, f.Wait.Count, f.Wait.Mean, f.Wait.P95, f.Wait.Max)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nfairness: floors %.3f, load %.3f (Jain's index, 1 is perfectly fair)\n", r.FloorFairness, r.LoadFairness)
+	return err
+}
+
+func statsColumns(s Stats) string {
+	return fmt.Sprintf("%d\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t", s.Count, s.Mean, s.P50, s.P90, s.P95, s.P99, s.Max)
+}
+
+// WriteCSV writes `r` as one table with a row per scope: the wait and journey of all calls, the
+// work of each elevator and the wait at each floor. Columns not applying to a scope are empty.
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+
+	cw.Write(csvRow("wait", "", r.Wait, strconv.Itoa(r.UnservedHall)))
+	cw.Write(csvRow("journey", "", r.Journey, strconv.Itoa(r.UnservedCab)))
+	for _, e := range r.Elevators {
+		cw.Write(csvRow("elevator", strconv.Itoa(e.ID), e.Wait, "",
+			strconv.Itoa(e.HallCallsServed), strconv.Itoa(e.CabCallsServed), strconv.Itoa(e.Stops),
+			strconv.Itoa(e.FloorsTravelled), strconv.Itoa(e.Reversals)))
+	}
+	for _, f := range r.Floors {
+		cw.Write(csvRow("floor", strconv.Itoa(f.Floor), f.Wait, ""))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var csvHeader = []string{"scope", "id", "count", "mean", "p50", "p90", "p95", "p99", "max", "unserved",
+	"hall_calls", "cab_calls", "stops", "floors_travelled", "reversals"}
+
+func csvRow(scope string, id string, s Stats, extra ...string) []string {
+	row := make([]string, 0, len(csvHeader))
+	row = append(row, scope, id, strconv.Itoa(s.Count))
+	for _, v := range []float64{s.Mean, s.P50, s.P90, s.P95, s.P99, s.Max} {
+		row = append(row, strconv.FormatFloat(v, 'f', 3, 64))
+	}
+	row = append(row, extra...)
+	for len(row) < len(csvHeader) {
+		row = append(row, "")
+	}
+	return row
+}
@@ -0,0 +1,225 @@
+// Package report computes dispatch performance from the event streams of the controllers, e.g.
+// journaled during a simulation, so changes to the cost function can be compared with numbers.
+package report
+
+import (
+	"elevator/controller"
+	"elevator/elevio"
+	"math"
+	"sort"
+	"time"
+)
+
+// Report summarises the service of all calls in the event streams of a group of elevators.
+// All times are in seconds.
+type Report struct {
+	Wait          Stats            `json:"wait"`    // from pressing a hall call until it is served
+	Journey       Stats            `json:"journey"` // from pressing a cab call until arriving at its floor
+	UnservedHall  int              `json:"unservedHallCalls"`
+	UnservedCab   int              `json:"unservedCabCalls"`
+	Elevators     []ElevatorReport `json:"elevators"`
+	Floors        []FloorReport    `json:"floors"`
+	FloorFairness float64          `json:"floorFairness"` // Jain's index of the mean waits per floor, 1 if all are equal
+	LoadFairness  float64          `json:"loadFairness"`  // Jain's index of the hall calls served per elevator
+}
+
+// Stats describes the distribution of a duration in seconds.
+type Stats struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// ElevatorReport is the work of one elevator. Floors travelled and direction reversals are a
+// proxy of the energy it used.
+type ElevatorReport struct {
+	ID              int   `json:"id"`
+	HallCallsServed int   `json:"hallCallsServed"`
+	CabCallsServed  int   `json:"cabCallsServed"`
+	Stops           int   `json:"stops"`
+	FloorsTravelled int   `json:"floorsTravelled"`
+	Reversals       int   `json:"reversals"`
+	Wait            Stats `json:"wait"` // of the hall calls served by this elevator
+}
+
+// FloorReport is the service of the hall calls pressed at one floor.
+type FloorReport struct {
+	Floor int   `json:"floor"`
+	Wait  Stats `json:"wait"`
+}
+
+// call is a button pressed at `pressed`, served at `served` or not yet if zero.
+type call struct {
+	button  elevio.ButtonEvent
+	pressed time.Time
+	served  time.Time
+	by      int // elevator which served the call
+}
+
+// New computes the report of the event `streams` of all elevators of a group. Each stream holds
+// the events of one elevator in order, as read from its journal.
+func New(streams [][]controller.Event) Report {
+	var r Report
+	var hallCalls []*call
+	var cabCalls []*call
+	elevators := make(map[int]*ElevatorReport)
+	var served []controller.Event // hall calls served, with the elevator in `ElevatorID`
+	numFloors := 0
+
+	for _, stream := range streams {
+		var e *ElevatorReport
+		direction := elevio.MD_Stop
+		pending := make(map[elevio.ButtonEvent][]*call) // cab calls of this elevator
+
+		for _, ev := range stream {
+			if e == nil && ev.Kind != controller.EV_Start {
+				continue
+			}
+			switch ev.Kind {
+			case controller.EV_Start:
+				if elevators[ev.ElevatorID] == nil {
+					elevators[ev.ElevatorID] = &ElevatorReport{ID: ev.ElevatorID}
+				}
+				e = elevators[ev.ElevatorID]
+				direction = elevio.MD_Stop
+				numFloors = max(numFloors, len(ev.Requests))
+			case controller.EV_Button:
+				c := &call{button: *ev.Button, pressed: ev.Time}
+				if ev.Button.Button == elevio.BT_Cab {
+					cabCalls = append(cabCalls, c)
+					pending[c.button] = append(pending[c.button], c)
+				} else {
+					hallCalls = append(hallCalls, c)
+				}
+			case controller.EV_Served:
+				if ev.Button.Button == elevio.BT_Cab {
+					for _, c := range pending[*ev.Button] {
+						c.served, c.by = ev.Time, e.ID
+					}
+					delete(pending, *ev.Button)
+					e.CabCallsServed++
+				} else {
+					ev.ElevatorID = e.ID
+					served = append(served, ev)
+					e.HallCallsServed++
+				}
+			case controller.EV_Floor:
+				e.FloorsTravelled++
+			case controller.EV_Door:
+				if ev.Value {
+					e.Stops++
+				}
+			case controller.EV_Motor:
+				if *ev.Direction != elevio.MD_Stop {
+					if direction != elevio.MD_Stop && *ev.Direction != direction {
+						e.Reversals++
+					}
+					direction = *ev.Direction
+				}
+			}
+		}
+	}
+
+	// A hall call is served by the first elevator serving its button after it was pressed,
+	// wherever it was pressed
+	sort.SliceStable(served, func(i, j int) bool { return served[i].Time.Before(served[j].Time) })
+	sort.SliceStable(hallCalls, func(i, j int) bool { return hallCalls[i].pressed.Before(hallCalls[j].pressed) })
+	for _, ev := range served {
+		for _, c := range hallCalls {
+			if c.button == *ev.Button && c.served.IsZero() && !c.pressed.After(ev.Time) {
+				c.served, c.by = ev.Time, ev.ElevatorID
+			}
+		}
+	}
+
+	var waits []time.Duration
+	waitsByElevator := make(map[int][]time.Duration)
+	waitsByFloor := make(map[int][]time.Duration)
+	for _, c := range hallCalls {
+		numFloors = max(numFloors, c.button.Floor+1)
+		if c.served.IsZero() {
+			r.UnservedHall++
+			continue
+		}
+		wait := c.served.Sub(c.pressed)
+		waits = append(waits, wait)
+		waitsByElevator[c.by] = append(waitsByElevator[c.by], wait)
+		waitsByFloor[c.button.Floor] = append(waitsByFloor[c.button.Floor], wait)
+	}
+	r.Wait = stats(waits)
+
+	var journeys []time.Duration
+	for _, c := range cabCalls {
+		if c.served.IsZero() {
+			r.UnservedCab++
+			continue
+		}
+		journeys = append(journeys, c.served.Sub(c.pressed))
+	}
+	r.Journey = stats(journeys)
+
+	var loads []float64
+	for _, e := range elevators {
+		e.Wait = stats(waitsByElevator[e.ID])
+		r.Elevators = append(r.Elevators, *e)
+		loads = append(loads, float64(e.HallCallsServed))
+	}
+	sort.Slice(r.Elevators, func(i, j int) bool { return r.Elevators[i].ID < r.Elevators[j].ID })
+	r.LoadFairness = jain(loads)
+
+	var meanWaits []float64
+	for floor := range numFloors {
+		f := FloorReport{Floor: floor, Wait: stats(waitsByFloor[floor])}
+		r.Floors = append(r.Floors, f)
+		if f.Wait.Count > 0 {
+			meanWaits = append(meanWaits, f.Wait.Mean)
+		}
+	}
+	r.FloorFairness = jain(meanWaits)
+	return r
+}
+
+func stats(durations []time.Duration) Stats {
+	if len(durations) == 0 {
+		return Stats{}
+	}
+	seconds := make([]float64, len(durations))
+	sum := 0.0
+	for i, d := range durations {
+		seconds[i] = d.Seconds()
+		sum += seconds[i]
+	}
+	sort.Float64s(seconds)
+	return Stats{
+		Count: len(seconds),
+		Mean:  sum / float64(len(seconds)),
+		P50:   percentile(seconds, 50),
+		P90:   percentile(seconds, 90),
+		P95:   percentile(seconds, 95),
+		P99:   percentile(seconds, 99),
+		Max:   seconds[len(seconds)-1],
+	}
+}
+
+// Returns the `p`th percentile of the sorted `values` by the nearest rank.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+// Returns Jain's fairness index of `values`: 1 if all are equal, down to 1/n if one gets everything.
+func jain(values []float64) float64 {
+	sum, squares := 0.0, 0.0
+	for _, v := range values {
+		sum += v
+		squares += v * v
+	}
+	if squares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(values)) * squares)
+}
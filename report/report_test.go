@@ -0,0 +1,118 @@
+package report
+
+import (
+	"elevator/controller"
+	"elevator/elevio"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+// Builds events of one elevator from `(seconds, event)` pairs.
+func stream(events ...any) []controller.Event {
+	var s []controller.Event
+	for i := 0; i < len(events); i += 2 {
+		ev := events[i+1].(controller.Event)
+		ev.Time = testStart.Add(time.Duration(events[i].(int)) * time.Second)
+		s = append(s, ev)
+	}
+	return s
+}
+
+func start(id int) controller.Event {
+	floor := 0
+	return controller.Event{Kind: controller.EV_Start, ElevatorID: id, Floor: &floor, Requests: make([][3]bool, 4)}
+}
+
+func button(kind controller.EventKind, floor int, btn elevio.ButtonType) controller.Event {
+	return controller.Event{Kind: kind, Button: &elevio.ButtonEvent{Floor: floor, Button: btn}}
+}
+
+func motor(dir elevio.MotorDirection) controller.Event {
+	return controller.Event{Kind: controller.EV_Motor, Direction: &dir}
+}
+
+func floor(f int) controller.Event {
+	return controller.Event{Kind: controller.EV_Floor, Floor: &f}
+}
+
+func TestReport_WaitJourneyAndWork(t *testing.T) {
+	door := controller.Event{Kind: controller.EV_Door, Value: true}
+	streams := [][]controller.Event{
+		// Elevator 0 takes the hall call at floor 2 pressed at its panel and a second press of it
+		stream(
+			0, start(0),
+			10, button(controller.EV_Button, 2, elevio.BT_HallUp),
+		),
+		// Elevator 1 is assigned the hall call, serves it and brings the passenger to floor 3,
+		// then returns to floor 1 for another cab call
+		stream(
+			0, start(1),
+			2, button(controller.EV_Button, 2, elevio.BT_HallUp),
+			2, motor(elevio.MD_Up),
+			4, floor(1),
+			6, floor(2),
+			6, door,
+			6, button(controller.EV_Served, 2, elevio.BT_HallUp),
+			7, button(controller.EV_Button, 3, elevio.BT_Cab),
+			7, button(controller.EV_Button, 1, elevio.BT_Cab),
+			9, floor(3),
+			9, door,
+			9, button(controller.EV_Served, 3, elevio.BT_Cab),
+			12, motor(elevio.MD_Down),
+			14, floor(2),
+			16, floor(1),
+			16, door,
+			16, button(controller.EV_Served, 1, elevio.BT_Cab),
+		),
+	}
+
+	r := New(streams)
+
+	// The press at floor 2 after it was served is not served yet
+	if r.Wait.Count != 1 || r.Wait.Mean != 4 || r.UnservedHall != 1 {
+		t.Errorf("Wait not as expected: %+v, %d unserved", r.Wait, r.UnservedHall)
+	}
+	if r.Journey.Count != 2 || r.Journey.Mean != 5.5 || r.Journey.Max != 9 || r.UnservedCab != 0 {
+		t.Errorf("Journey not as expected: %+v", r.Journey)
+	}
+	expected := ElevatorReport{ID: 1, HallCallsServed: 1, CabCallsServed: 2, Stops: 3, FloorsTravelled: 5, Reversals: 1, Wait: r.Wait}
+	if len(r.Elevators) != 2 || r.Elevators[1] != expected {
+		t.Errorf("Work of elevator 1 not as expected.\nExpected: %+v\nWas: %+v", expected, r.Elevators)
+	}
+	if len(r.Floors) != 4 || r.Floors[2].Wait.Count != 1 || r.Floors[0].Wait.Count != 0 {
+		t.Errorf("Floors not as expected: %+v", r.Floors)
+	}
+	if r.LoadFairness != 0.5 {
+		t.Errorf("Expected load fairness 0.5 with one of two elevators serving everything, was %v", r.LoadFairness)
+	}
+}
+
+func TestReport_Formats(t *testing.T) {
+	r := New([][]controller.Event{stream(
+		0, start(0),
+		1, button(controller.EV_Button, 1, elevio.BT_HallDown),
+		3, button(controller.EV_Served, 1, elevio.BT_HallDown),
+	)})
+
+	var text strings.Builder
+	if err := r.WriteText(&text); err != nil || !strings.Contains(text.String(), "fairness") {
+		t.Errorf("Text report not as expected (%v):\n%s", err, text.String())
+	}
+
+	var buf strings.Builder
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header, wait, journey, one elevator and 4 floors
+	if len(records) != 8 || records[1][0] != "wait" || records[1][3] != "2.000" {
+		t.Errorf("CSV report not as expected:\n%s", buf.String())
+	}
+}
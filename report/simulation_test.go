@@ -0,0 +1,33 @@
+//go:build go1.25
+
+package report
+
+import (
+	"elevator/logging"
+	"elevator/sim"
+	"elevator/traffic"
+	"log/slog"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestReport_FromSimulation(t *testing.T) {
+	logging.SetLevel("", slog.LevelError)
+	synctest.Test(t, func(t *testing.T) {
+		cfg := sim.Config{Elevators: 3, Floors: 4, Settle: synctest.Wait}
+		s := sim.New(cfg)
+		defer s.Close()
+		calls := traffic.Lunch.Generate(traffic.Config{Floors: 4, Elevators: 3, Duration: 30 * time.Second, Rate: 12, Seed: 3})
+		s.Press(calls...)
+		s.Run(90 * time.Second)
+
+		r := New(s.Events())
+		if r.Wait.Count != len(calls) || r.UnservedHall != 0 || r.UnservedCab != 0 {
+			t.Errorf("Expected all %d hall calls and their journeys to be served, was %+v", len(calls), r)
+		}
+		if r.Journey.Count != len(calls) || r.Journey.Mean <= 0 {
+			t.Errorf("Expected a journey per passenger, was %+v", r.Journey)
+		}
+	})
+}
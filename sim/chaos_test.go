@@ -0,0 +1,95 @@
+//go:build go1.25
+
+package sim
+
+import (
+	"elevator/chaos"
+	"elevator/controller"
+	"elevator/elevio"
+	"elevator/traffic"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulation_ServesAllCallsDespiteFaults(t *testing.T) {
+	timelines := map[string]chaos.Timeline{
+		"kill":              {{At: 10 * time.Second, Node: 1, Kind: chaos.FK_Kill}},
+		"freeze":            {{At: 5 * time.Second, Node: 0, Kind: chaos.FK_Freeze, Duration: 5 * time.Second}},
+		"drop":              {{At: 5 * time.Second, Node: 2, Kind: chaos.FK_DropPackets, Rate: 0.5, Duration: 20 * time.Second}},
+		"delay":             {{At: 5 * time.Second, Node: 2, Kind: chaos.FK_DelayPackets, Port: "assigner", Delay: 300 * time.Millisecond, Duration: 20 * time.Second}},
+		"hold obstruction":  {{At: 5 * time.Second, Node: 0, Kind: chaos.FK_HoldObstruction, Duration: 10 * time.Second}},
+		"jam motor":         {{At: 5 * time.Second, Node: 1, Kind: chaos.FK_JamMotor, Duration: 10 * time.Second}},
+		"disconnect driver": {{At: 5 * time.Second, Node: 2, Kind: chaos.FK_DisconnectDriver, Duration: 500 * time.Millisecond}},
+	}
+	for name, timeline := range timelines {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{Elevators: 3, Floors: 4}
+			simulate(t, cfg, func(t *testing.T, s *Simulation) {
+				s.Press(passengers(traffic.Random, cfg, 11)...)
+				if err := s.Inject(timeline); err != nil {
+					t.Fatal(err)
+				}
+				s.Run(90 * time.Second)
+
+				for _, err := range s.Check() {
+					t.Error(err)
+				}
+			})
+		})
+	}
+}
+
+func TestSimulation_DetectsCallsLostToFaults(t *testing.T) {
+	cfg := Config{Elevators: 2, Floors: 4}
+	simulate(t, cfg, func(t *testing.T, s *Simulation) {
+		s.Press(traffic.Call{At: time.Second, Floor: 3, Button: elevio.BT_Cab})
+		s.Inject(chaos.Timeline{{Node: 0, Kind: chaos.FK_JamMotor}, {At: 20 * time.Second, Node: 1, Kind: chaos.FK_Kill}})
+		s.Run(30 * time.Second)
+
+		if errs := s.Check(); len(errs) != 1 {
+			t.Errorf("Expected the cab call of the jammed elevator not to be served, was %v", errs)
+		}
+		if _, killed := s.Node(1).Killed(); !killed {
+			t.Error("Expected elevator 1 to be killed")
+		}
+		if faults := s.Node(0).Faults(); len(faults) != 1 || faults[0].Kind != chaos.FK_JamMotor {
+			t.Errorf("Expected the motor of elevator 0 to stay jammed, was %v", faults)
+		}
+	})
+}
+
+func TestSimulation_HandsOverHallCallsOfJammedMotor(t *testing.T) {
+	cfg := Config{Elevators: 2, Floors: 4}
+	simulate(t, cfg, func(t *testing.T, s *Simulation) {
+		s.Inject(chaos.Timeline{{Node: 0, Kind: chaos.FK_JamMotor, Duration: time.Minute}})
+		s.Press(
+			traffic.Call{At: time.Second, Floor: 3, Button: elevio.BT_Cab},
+			traffic.Call{At: 2 * time.Second, Floor: 3, Button: elevio.BT_HallDown},
+		)
+		s.Run(20 * time.Second)
+
+		if errs := s.Check(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "cab") {
+			t.Errorf("Expected only the cab call of the jammed elevator not to be served, was %v", errs)
+		}
+	})
+}
+
+func TestSimulation_HandsOverHallCallsOnShutdown(t *testing.T) {
+	cfg := Config{Elevators: 2, Floors: 4}
+	simulate(t, cfg, func(t *testing.T, s *Simulation) {
+		s.Press(traffic.Call{At: time.Second, Floor: 3, Button: elevio.BT_HallDown})
+		s.Run(2 * time.Second)
+		s.Stop(0)
+		// Elevator 1 needs 6s to reach floor 3, so it only makes it if the call was handed over at
+		// once rather than after peers detected a silent elevator
+		s.Run(6500 * time.Millisecond)
+
+		if errs := s.Check(); len(errs) != 0 {
+			t.Errorf("Expected elevator 1 to take over the hall call at once, was %v", errs)
+		}
+		if event := s.Events()[0]; event[len(event)-1].Kind != controller.EV_Motor {
+			t.Errorf("Expected elevator 0 to stop its motor last, was %v", event[len(event)-1])
+		}
+	})
+}
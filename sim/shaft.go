@@ -0,0 +1,240 @@
+package sim
+
+import (
+	"elevator/clock"
+	"elevator/controller"
+	"elevator/elevio"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// floorSensorTime is how long the floor sensor detects a car passing a floor.
+const floorSensorTime = 100 * time.Millisecond
+
+// Shaft simulates the hardware of one elevator: a car which reaches the next floor `travelTime`
+// after leaving the previous one, its door and its lamps. It records everything the controller does.
+type Shaft struct {
+	mtx        sync.Mutex
+	id         int
+	numFloors  int
+	clock      clock.Clock
+	travelTime time.Duration
+	inputs     controller.Inputs
+	onDoorOpen func(floor int) // called in its own goroutine whenever the door opens
+	done       chan struct{}   // closed once the controller stopped reading the inputs
+
+	below      int  // floor the car is at, or the floor below the car if between floors
+	between    bool // whether the car is between `below` and `below+1`
+	direction  elevio.MotorDirection
+	generation int // incremented on every change of the motor direction
+	arrival    clock.Timer
+	doorOpen   bool
+	lamps      [][3]bool
+
+	doors      []doorInterval
+	lampEvents []lampEvent
+	violations []violation
+}
+
+// violation of the physics of the shaft at `at`.
+type violation struct {
+	at          time.Time
+	description string
+}
+
+// doorInterval is a time the door was open at `floor`. `closed` is zero while it is still open.
+type doorInterval struct {
+	floor  int
+	opened time.Time
+	closed time.Time
+}
+
+type lampEvent struct {
+	at     time.Time
+	button elevio.ButtonEvent
+	on     bool
+}
+
+func newShaft(id int, numFloors int, clk clock.Clock, travelTime time.Duration) *Shaft {
+	return &Shaft{
+		id:         id,
+		numFloors:  numFloors,
+		clock:      clk,
+		travelTime: travelTime,
+		inputs: controller.Inputs{
+			Buttons:     make(chan elevio.ButtonEvent),
+			Floors:      make(chan int),
+			Obstruction: make(chan bool),
+			Stop:        make(chan bool),
+		},
+		lamps: make([][3]bool, numFloors),
+		done:  make(chan struct{}),
+	}
+}
+
+// Gives up all inputs not read yet. Must be called once the controller stopped.
+func (s *Shaft) close() {
+	close(s.done)
+}
+
+// press presses button `b` on the panels of this elevator.
+func (s *Shaft) press(b elevio.ButtonEvent) {
+	go func() {
+		select {
+		case s.inputs.Buttons <- b:
+		case <-s.done:
+		}
+	}()
+}
+
+func (s *Shaft) SetMotorDirection(dir elevio.MotorDirection) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if dir == s.direction {
+		return
+	}
+	s.direction = dir
+	s.generation++
+	if s.arrival != nil {
+		s.arrival.Stop()
+		s.arrival = nil
+	}
+	if dir != elevio.MD_Stop {
+		if s.doorOpen {
+			s.violate("motor started with open door")
+		}
+		s.depart()
+	}
+}
+
+// Leaves the current position in the motor direction. Must be called while holding `mtx`.
+func (s *Shaft) depart() {
+	target := s.below + 1
+	if s.direction == elevio.MD_Down && !s.between {
+		target = s.below - 1
+	} else if s.direction == elevio.MD_Down {
+		target = s.below
+	}
+	if target < 0 || target >= s.numFloors {
+		s.violate(fmt.Sprintf("drove past the end of the shaft towards floor %d", target))
+		return
+	}
+	travelTime := s.travelTime
+	if !s.between {
+		// The car already spent the time the floor sensor is active at the floor
+		travelTime -= floorSensorTime
+		s.between = true
+		s.below = min(s.below, target)
+	}
+
+	generation := s.generation
+	s.arrival = s.clock.AfterFunc(travelTime, func() { s.arrive(target, generation) })
+}
+
+// Arrives at floor `target` if the motor direction did not change since leaving for it. The car
+// passes the floor within `floorSensorTime` unless the motor was stopped.
+func (s *Shaft) arrive(target int, generation int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if generation != s.generation {
+		return
+	}
+	s.below = target
+	s.between = false
+	go func() {
+		select {
+		case s.inputs.Floors <- target:
+		case <-s.done:
+		}
+	}()
+
+	s.arrival = s.clock.AfterFunc(floorSensorTime, func() {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		if generation == s.generation {
+			s.depart()
+		}
+	})
+}
+
+func (s *Shaft) SetButtonLamp(button elevio.ButtonType, floor int, value bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.lamps[floor][button] == value {
+		return
+	}
+	s.lamps[floor][button] = value
+	s.lampEvents = append(s.lampEvents, lampEvent{s.clock.Now(), elevio.ButtonEvent{Floor: floor, Button: button}, value})
+}
+
+func (s *Shaft) SetFloorIndicator(floor int) {
+}
+
+func (s *Shaft) SetDoorOpenLamp(value bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if value == s.doorOpen {
+		return
+	}
+	s.doorOpen = value
+	if !value {
+		s.doors[len(s.doors)-1].closed = s.clock.Now()
+		return
+	}
+	if s.between || s.direction != elevio.MD_Stop {
+		s.violate("door opened while moving")
+	}
+	s.doors = append(s.doors, doorInterval{floor: s.below, opened: s.clock.Now()})
+	if s.onDoorOpen != nil {
+		go s.onDoorOpen(s.below)
+	}
+}
+
+// Reports whether the door is open at `floor`.
+func (s *Shaft) doorOpenAt(floor int) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.doorOpen && !s.between && s.below == floor
+}
+
+func (s *Shaft) GetFloor() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.between {
+		return -1
+	}
+	return s.below
+}
+
+// Records a violation of the physics of the shaft. Must be called while holding `mtx`.
+func (s *Shaft) violate(description string) {
+	s.violations = append(s.violations, violation{s.clock.Now(), description})
+}
+
+// shaftRecord is a copy of everything recorded by a shaft.
+type shaftRecord struct {
+	doors      []doorInterval
+	lampEvents []lampEvent
+	lamps      [][3]bool
+	violations []violation
+}
+
+func (s *Shaft) record() shaftRecord {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return shaftRecord{
+		doors:      append([]doorInterval(nil), s.doors...),
+		lampEvents: append([]lampEvent(nil), s.lampEvents...),
+		lamps:      append([][3]bool(nil), s.lamps...),
+		violations: append([]violation(nil), s.violations...),
+	}
+}
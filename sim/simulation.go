@@ -0,0 +1,421 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"elevator/chaos"
+	"elevator/clock"
+	"elevator/controller"
+	"elevator/elevio"
+	"elevator/traffic"
+	"elevator/transport"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Simulation runs several elevators with simulated shafts on an in-memory network in one
+// process. All elevators, shafts and the network share one fake clock which only advances in
+// `Run`, so a minute of traffic takes a fraction of it. Simulations must be closed once done.
+type Simulation struct {
+	cfg     Config
+	clock   *clock.Fake
+	start   time.Time
+	network *transport.Network
+	shafts  []*Shaft
+	nodes   []*chaos.Node
+	events  []*lockedBuffer // journal of each controller
+	stops   []func()        // shuts each controller down, returns once it stopped
+
+	mtx     sync.Mutex
+	presses []press
+	waiting []press     // passengers with a destination waiting for a car
+	stopped []time.Time // when each elevator was shut down, zero while running
+	frozen  []interval  // when elevators were frozen by injected faults
+}
+
+// interval is a time elevator `id` was frozen. `until` is zero if it stays frozen.
+type interval struct {
+	id    int
+	from  time.Time
+	until time.Time
+}
+
+// Config describes the building and the network of a simulation.
+type Config struct {
+	Elevators  int
+	Floors     int
+	TravelTime time.Duration // from one floor to the next, 2s if zero
+
+	// Impairments of the network. Its generator is seeded with `Network.Seed`.
+	Network transport.NetworkConfig
+
+	// The fake clock jumps from one deadline of a timer to the next. After every jump `Settle`
+	// returns once all elevators reacted. Tests running the simulation in a bubble of
+	// `synctest.Test` pass `synctest.Wait`, so runs are reproducible. If nil the elevators get
+	// `settleTime` of real time, after which they most likely reacted.
+	Settle func()
+}
+
+type press struct {
+	call traffic.Call
+	at   time.Time
+}
+
+// Timestamps of simulations begin here, so runs are reproducible.
+var simulationStart = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+// lampTolerance is how long a lamp may lag behind the call it shows.
+const lampTolerance = 1 * time.Second
+
+// settleTime is the real time the elevators get to react after every jump of the clock, unless
+// `Config.Settle` is set.
+const settleTime = 200 * time.Microsecond
+
+// Yields to the elevators for `settleTime` of real time.
+func settle() {
+	for start := time.Now(); time.Since(start) < settleTime; {
+		runtime.Gosched()
+	}
+}
+
+// New creates the simulation described by `cfg` and starts all elevators idle at floor 0.
+func New(cfg Config) *Simulation {
+	if cfg.TravelTime == 0 {
+		cfg.TravelTime = 2 * time.Second
+	}
+	if cfg.Settle == nil {
+		cfg.Settle = settle
+	}
+	clk := clock.NewFake(simulationStart)
+	cfg.Network.Clock = clk
+
+	s := &Simulation{
+		cfg:     cfg,
+		clock:   clk,
+		start:   simulationStart,
+		network: transport.NewNetwork(cfg.Network),
+		stopped: make([]time.Time, cfg.Elevators),
+	}
+	for id := range cfg.Elevators {
+		shaft := newShaft(id, cfg.Floors, clk, cfg.TravelTime)
+		shaft.onDoorOpen = func(floor int) { s.board(id, floor) }
+		s.shafts = append(s.shafts, shaft)
+
+		// Floors pass the chaos driver, which holds them back while it is disconnected
+		driver := chaos.NewDriver(shaft)
+		inputs := shaft.inputs
+		inputs.Floors = make(chan int)
+		tr := chaos.NewTransport(s.network.Node(id), clk, cfg.Network.Seed+int64(id))
+		c := controller.New(id, cfg.Floors, driver, inputs, tr, clk)
+		c.SuperviseMotor(cfg.TravelTime)
+		s.nodes = append(s.nodes, c.ChaosNode(tr, driver, nil))
+		events := &lockedBuffer{}
+		c.JournalTo(events, fmt.Sprintf("simulation elevator %d", id))
+		s.events = append(s.events, events)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go driver.GateFloors(ctx, shaft.inputs.Floors, inputs.Floors)
+		go func() {
+			defer close(done)
+			c.Run(ctx)
+		}()
+		s.stops = append(s.stops, func() {
+			cancel()
+			<-done
+		})
+	}
+	return s
+}
+
+// Stop shuts elevator `id` down in order, as an operator would for maintenance. Returns once it
+// stopped. Like killed elevators, it is excused from the calls it did not serve.
+func (s *Simulation) Stop(id int) {
+	s.stops[id]()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.stopped[id].IsZero() {
+		s.stopped[id] = s.clock.Now()
+	}
+}
+
+// Network returns the network between the elevators, e.g. to partition it while running.
+func (s *Simulation) Network() *transport.Network {
+	return s.network
+}
+
+// Elapsed returns the simulated time since the start.
+func (s *Simulation) Elapsed() time.Duration {
+	return s.clock.Since(s.start)
+}
+
+// Node returns elevator `id` to inject faults into.
+func (s *Simulation) Node(id int) *chaos.Node {
+	return s.nodes[id]
+}
+
+// Inject schedules the faults of `timeline`, timed from the start of the simulation.
+func (s *Simulation) Inject(timeline chaos.Timeline) error {
+	shifted := make(chaos.Timeline, len(timeline))
+	for i, f := range timeline {
+		shifted[i] = f
+		shifted[i].At = max(f.At-s.Elapsed(), 0)
+	}
+	if err := shifted.Start(s.nodes, s.clock); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, f := range shifted {
+		if f.Kind != chaos.FK_Freeze {
+			continue
+		}
+		frozen := interval{id: f.Node, from: s.clock.Now().Add(f.At)}
+		if f.Duration > 0 {
+			frozen.until = frozen.from.Add(f.Duration)
+		}
+		s.frozen = append(s.frozen, frozen)
+	}
+	return nil
+}
+
+// Events returns the events journaled by the controller of each elevator so far.
+func (s *Simulation) Events() [][]controller.Event {
+	streams := make([][]controller.Event, len(s.events))
+	for id, events := range s.events {
+		runs, err := controller.ReadJournal(events.reader())
+		if err != nil {
+			panic(err)
+		}
+		for _, run := range runs {
+			streams[id] = append(streams[id], run...)
+		}
+	}
+	return streams
+}
+
+// lockedBuffer is a buffer written by a controller while the simulation reads it.
+type lockedBuffer struct {
+	mtx sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// Returns a reader of a copy of everything written so far.
+func (b *lockedBuffer) reader() io.Reader {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return bytes.NewReader(bytes.Clone(b.buf.Bytes()))
+}
+
+// Press schedules all `calls`, timed from the start of the simulation. Passengers with a
+// destination board the first car opening its door at their floor and press their cab button.
+func (s *Simulation) Press(calls ...traffic.Call) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, call := range calls {
+		p := press{call, s.start.Add(call.At)}
+		s.clock.AfterFunc(call.At-s.Elapsed(), func() {
+			s.shafts[call.Elevator].press(elevio.ButtonEvent{Floor: call.Floor, Button: call.Button})
+			if call.Destination != nil && *call.Destination != call.Floor {
+				s.wait(p)
+			}
+		})
+		s.presses = append(s.presses, p)
+	}
+}
+
+// Lets the passenger of press `p` wait for a car, or board one with its door open at its floor.
+func (s *Simulation) wait(p press) {
+	s.mtx.Lock()
+	s.waiting = append(s.waiting, p)
+	s.mtx.Unlock()
+
+	for id, shaft := range s.shafts {
+		if shaft.doorOpenAt(p.call.Floor) {
+			s.board(id, p.call.Floor)
+			return
+		}
+	}
+}
+
+// Boards all passengers waiting at `floor` into the car of elevator `id`.
+func (s *Simulation) board(id int, floor int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	waiting := s.waiting[:0]
+	for _, p := range s.waiting {
+		if p.call.Floor != floor {
+			waiting = append(waiting, p)
+			continue
+		}
+		cab := traffic.Call{At: s.Elapsed(), Floor: *p.call.Destination, Button: elevio.BT_Cab, Elevator: id}
+		s.shafts[id].press(elevio.ButtonEvent{Floor: cab.Floor, Button: cab.Button})
+		s.presses = append(s.presses, press{cab, s.start.Add(cab.At)})
+	}
+	s.waiting = waiting
+}
+
+// Run advances the simulation by `d`, one timer at a time.
+func (s *Simulation) Run(d time.Duration) {
+	end := s.clock.Now().Add(d)
+	s.cfg.Settle()
+	for s.clock.Step(end) {
+		s.cfg.Settle()
+	}
+	s.clock.Advance(end.Sub(s.clock.Now()))
+}
+
+// Close injects no more faults, stops all elevators still running and returns once they stopped.
+// The simulation cannot run on afterwards.
+func (s *Simulation) Close() {
+	for _, node := range s.nodes {
+		node.Stop()
+	}
+	for _, stop := range s.stops {
+		stop()
+	}
+	for _, shaft := range s.shafts {
+		shaft.close()
+	}
+}
+
+// Check verifies the service guarantees for all calls pressed so far:
+//   - every hall call is served by an elevator opening its door at its floor
+//   - every cab call is served by its elevator
+//   - no lamp lies: a lamp only turns on for a call pressed and not served for `lampTolerance`,
+//     and all lamps are off once all calls are served
+//   - no elevator moves with open door or beyond the ends of the shaft
+//
+// Killed and stopped elevators are excused from calls pressed at their panels after they were
+// killed or stopped and from their cab calls not served before. Elevators frozen by faults
+// injected with `Inject` are excused from where their car went while they could not stop it.
+func (s *Simulation) Check() []error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	records := make([]shaftRecord, len(s.shafts))
+	for i, shaft := range s.shafts {
+		records[i] = shaft.record()
+	}
+
+	var errs []error
+	allServed := true
+	for _, p := range s.presses {
+		if _, served := servedAt(records, p); !served && !s.excused(p) {
+			allServed = false
+			errs = append(errs, fmt.Errorf("%s not served", p))
+		}
+	}
+
+	for id, r := range records {
+		for _, v := range r.violations {
+			if !s.frozenAt(id, v.at) {
+				errs = append(errs, fmt.Errorf("elevator %d at %v: %s", id, v.at.Format("15:04:05.000"), v.description))
+			}
+		}
+		for _, event := range r.lampEvents {
+			if event.on && !s.legitimate(records, id, event) {
+				errs = append(errs, fmt.Errorf("elevator %d turned on lamp %+v at %v without a pending call",
+					id, event.button, event.at.Sub(s.start)))
+			}
+		}
+		_, gone := s.gone(id)
+		for floor, lamps := range r.lamps {
+			for btn, on := range lamps {
+				if on && allServed && !gone {
+					errs = append(errs, fmt.Errorf("elevator %d still shows lamp floor=%d button=%d after all calls were served",
+						id, floor, btn))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// Reports whether press `p` need not be served since its elevator was killed or stopped. Must be
+// called while holding `mtx`.
+func (s *Simulation) excused(p press) bool {
+	goneAt, gone := s.gone(p.call.Elevator)
+	return gone && (!p.at.Before(goneAt) || p.call.Button == elevio.BT_Cab)
+}
+
+// Returns when elevator `id` was killed or stopped, or false if it is running. Must be called
+// while holding `mtx`.
+func (s *Simulation) gone(id int) (time.Time, bool) {
+	if killedAt, killed := s.nodes[id].Killed(); killed {
+		return killedAt, true
+	}
+	return s.stopped[id], !s.stopped[id].IsZero()
+}
+
+// Reports whether elevator `id` was frozen at `t`, so it could not stop its car. Must be called
+// while holding `mtx`.
+func (s *Simulation) frozenAt(id int, t time.Time) bool {
+	for _, f := range s.frozen {
+		if f.id == id && !t.Before(f.from) && (f.until.IsZero() || t.Before(f.until)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns when press `p` was served. A call is served once an elevator which may serve it has its
+// door open at the floor of the call.
+func servedAt(records []shaftRecord, p press) (time.Time, bool) {
+	var servedAt time.Time
+	served := false
+	for id, r := range records {
+		if p.call.Button == elevio.BT_Cab && id != p.call.Elevator {
+			continue
+		}
+		for _, door := range r.doors {
+			if door.floor != p.call.Floor || (!door.closed.IsZero() && !door.closed.After(p.at)) {
+				continue
+			}
+			at := door.opened
+			if at.Before(p.at) {
+				at = p.at
+			}
+			if !served || at.Before(servedAt) {
+				servedAt, served = at, true
+			}
+		}
+	}
+	return servedAt, served
+}
+
+// Reports whether elevator `id` may turn on a lamp as in `event`. Must be called while holding `mtx`.
+func (s *Simulation) legitimate(records []shaftRecord, id int, event lampEvent) bool {
+	for _, p := range s.presses {
+		if p.call.Floor != event.button.Floor || p.call.Button != event.button.Button || p.at.After(event.at) {
+			continue
+		}
+		if p.call.Button == elevio.BT_Cab && p.call.Elevator != id {
+			continue
+		}
+		at, served := servedAt(records, p)
+		if !served || !at.Before(event.at.Add(-lampTolerance)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p press) String() string {
+	return p.call.String()
+}
@@ -0,0 +1,102 @@
+//go:build go1.25
+
+package sim
+
+import (
+	"elevator/elevio"
+	"elevator/logging"
+	"elevator/traffic"
+	"elevator/transport"
+	"flag"
+	"log/slog"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+var seeds = flag.Int("seeds", 4, "number of seeded scenarios run by TestSimulation_ServesAllCalls")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	logging.SetLevel("", slog.LevelError)
+	m.Run()
+}
+
+// Returns the traffic of profile `p` during the first 30s of a simulation of `cfg`, drawn from `seed`.
+func passengers(p traffic.Profile, cfg Config, seed int64) []traffic.Call {
+	return p.Generate(traffic.Config{Floors: cfg.Floors, Elevators: cfg.Elevators, Duration: 30 * time.Second, Rate: 12, Seed: seed})
+}
+
+func TestSimulation_ServesAllCalls(t *testing.T) {
+	n := *seeds
+	if testing.Short() {
+		n = 1
+	}
+	for seed := range int64(n) {
+		cfg := Config{Elevators: 3, Floors: 4, Network: transport.NetworkConfig{Seed: seed}}
+		profile := traffic.Profiles[seed%int64(len(traffic.Profiles))]
+		simulate(t, cfg, func(t *testing.T, s *Simulation) {
+			s.Press(passengers(profile, cfg, seed)...)
+			s.Run(90 * time.Second)
+
+			for _, err := range s.Check() {
+				t.Errorf("seed %d, %s: %v", seed, profile.Name, err)
+			}
+		})
+	}
+}
+
+func TestSimulation_ServesAllCallsOnLossyNetwork(t *testing.T) {
+	cfg := Config{
+		Elevators: 3,
+		Floors:    4,
+		Network:   transport.NetworkConfig{Seed: 7, LossRate: 0.2, DuplicateRate: 0.1, Latency: 5 * time.Millisecond, Jitter: 10 * time.Millisecond},
+	}
+	simulate(t, cfg, func(t *testing.T, s *Simulation) {
+		s.Press(passengers(traffic.Random, cfg, 7)...)
+		s.Run(90 * time.Second)
+
+		for _, err := range s.Check() {
+			t.Error(err)
+		}
+	})
+}
+
+func TestSimulation_DetectsUnservedCalls(t *testing.T) {
+	cfg := Config{Elevators: 2, Floors: 4}
+	simulate(t, cfg, func(t *testing.T, s *Simulation) {
+		s.Press(traffic.Call{At: time.Second, Floor: 3, Button: elevio.BT_HallDown})
+		s.Run(2 * time.Second)
+
+		if errs := s.Check(); len(errs) != 1 {
+			t.Errorf("Expected the hall call not to be served yet, was %v", errs)
+		}
+	})
+}
+
+func TestSimulation_PassengersRideToTheirDestination(t *testing.T) {
+	cfg := Config{Elevators: 2, Floors: 4}
+	simulate(t, cfg, func(t *testing.T, s *Simulation) {
+		destination := 1
+		s.Press(traffic.Call{At: time.Second, Floor: 3, Button: elevio.BT_HallDown, Elevator: 1, Destination: &destination})
+		s.Run(30 * time.Second)
+
+		if errs := s.Check(); len(errs) != 0 {
+			t.Errorf("Expected all calls to be served, was %v", errs)
+		}
+		if len(s.presses) != 2 || s.presses[1].call.Button != elevio.BT_Cab || s.presses[1].call.Floor != destination {
+			t.Errorf("Expected the passenger to press its destination in the car, was %v", s.presses)
+		}
+	})
+}
+
+// simulate runs `f` on a new simulation of `cfg` in a bubble of `synctest.Test`, which settles
+// with `synctest.Wait`.
+func simulate(t *testing.T, cfg Config, f func(t *testing.T, s *Simulation)) {
+	cfg.Settle = synctest.Wait
+	synctest.Test(t, func(t *testing.T) {
+		s := New(cfg)
+		defer s.Close()
+		f(t, s)
+	})
+}
@@ -0,0 +1,32 @@
+package statesync
+
+import "time"
+
+const offlineTimeout = 1 * time.Second
+
+// connectivity decides whether this elevator lost the network entirely. We are offline once our
+// broadcasts fail and no other elevator has been heard for `offlineTimeout`, and back online as
+// soon as a broadcast succeeds or another elevator is heard again.
+type connectivity struct {
+	sendFailing   bool
+	lastPeerHeard time.Time
+	offline       bool
+}
+
+// sent records the result of a broadcast.
+func (c *connectivity) sent(err error) {
+	c.sendFailing = err != nil
+}
+
+// heard records a message of another elevator received at `now`.
+func (c *connectivity) heard(now time.Time) {
+	c.lastPeerHeard = now
+}
+
+// update re-evaluates the connectivity at `now` and reports whether we went offline or online.
+func (c *connectivity) update(now time.Time) (changed bool) {
+	offline := c.sendFailing && now.Sub(c.lastPeerHeard) > offlineTimeout
+	changed = offline != c.offline
+	c.offline = offline
+	return changed
+}
@@ -0,0 +1,34 @@
+package statesync
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConnectivity_OfflineOnlyWhenSendsFailAndPeersSilent(t *testing.T) {
+	var c connectivity
+	start := time.Now()
+	c.heard(start)
+
+	c.sent(errors.New("network is unreachable"))
+	if c.update(start.Add(offlineTimeout / 2)) {
+		t.Errorf("Expected to stay online while peers were heard recently")
+	}
+	if !c.update(start.Add(2*offlineTimeout)) || !c.offline {
+		t.Errorf("Expected to go offline with failing sends and silent peers")
+	}
+
+	c.sent(nil)
+	if !c.update(start.Add(3*offlineTimeout)) || c.offline {
+		t.Errorf("Expected to go back online once sends succeed")
+	}
+}
+
+func TestConnectivity_SingleElevatorOnHealthyNetworkStaysOnline(t *testing.T) {
+	var c connectivity
+	c.sent(nil)
+	if c.update(time.Now().Add(time.Hour)) || c.offline {
+		t.Errorf("Expected to stay online without peers while sends succeed")
+	}
+}
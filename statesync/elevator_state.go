@@ -2,27 +2,61 @@ package statesync
 
 import (
 	"elevator/elevio"
+	"elevator/types"
 	"encoding/binary"
 	"time"
 )
 
 type elevatorState struct {
 	id            int
+	incarnation   uint32
 	nonce         int
 	currFloor     int
 	currDirection elevio.MotorDirection
+	availability  types.Availability
+	behaviour     types.Behaviour
+	doorOpen      bool
+	obstructed    bool
+	betweenFloors bool
+	capacity      int
 	request       [][3]bool
 	lastSync      time.Time
 }
 
-// Serializes an elevatorState into a byte slice.
+// Bits of the flags byte of a state.
+const (
+	flagDoorOpen      = 1 << 0
+	flagObstructed    = 1 << 1
+	flagBetweenFloors = 1 << 2
+)
+
+// Serializes an elevatorState into a byte slice. The requests are followed by no extensions yet,
+// but decoders skip any bytes after them, so fields can be added without a new message type.
 func serialize(s elevatorState) []byte {
 	buf := make([]byte, 0, 128)
 
+	buf = append(buf, byte(msgStateV2))
 	buf = append(buf, uint8(s.id))
+	buf = binary.LittleEndian.AppendUint32(buf, s.incarnation)
 	buf = binary.LittleEndian.AppendUint32(buf, uint32(s.nonce))
 	buf = append(buf, uint8(s.currFloor))
 	buf = append(buf, byte(s.currDirection))
+	buf = append(buf, byte(s.availability))
+	buf = append(buf, byte(s.behaviour))
+
+	flags := byte(0)
+	if s.doorOpen {
+		flags |= flagDoorOpen
+	}
+	if s.obstructed {
+		flags |= flagObstructed
+	}
+	if s.betweenFloors {
+		flags |= flagBetweenFloors
+	}
+	buf = append(buf, flags)
+	buf = append(buf, uint8(s.capacity))
+	buf = append(buf, uint8(len(s.request)))
 
 	for _, row := range s.request {
 		for _, btn := range row {
@@ -37,18 +71,29 @@ func serialize(s elevatorState) []byte {
 	return buf
 }
 
-// Deserializes a byte slice into an elevatorState.
+// Deserializes a byte slice into an elevatorState. States of the legacy format only carry the
+// floor, direction and requests, all other fields are left at their defaults.
 func deserialize(m []byte) *elevatorState {
 	elevatorState := &elevatorState{
-		id:            int(m[0]),
-		nonce:         int(binary.LittleEndian.Uint32(m[1:5])),
-		currFloor:     int(m[5]),
-		currDirection: elevio.MotorDirection(int8(m[6])),
+		id:            int(m[1]),
+		incarnation:   binary.LittleEndian.Uint32(m[2:6]),
+		nonce:         int(binary.LittleEndian.Uint32(m[6:10])),
+		currFloor:     int(m[10]),
+		currDirection: elevio.MotorDirection(int8(m[11])),
 		request:       make([][3]bool, 0, 128),
 	}
 
-	offset := 7
-	for i := offset; i < len(m); i += 3 {
+	offset, end := legacyStateHeaderLength, len(m)
+	if messageType(m[0]) == msgStateV2 {
+		elevatorState.availability = types.Availability(m[12])
+		elevatorState.behaviour = types.Behaviour(m[13])
+		elevatorState.doorOpen = m[14]&flagDoorOpen != 0
+		elevatorState.obstructed = m[14]&flagObstructed != 0
+		elevatorState.betweenFloors = m[14]&flagBetweenFloors != 0
+		elevatorState.capacity = int(m[15])
+		offset, end = stateHeaderLength, stateHeaderLength+3*int(m[16])
+	}
+	for i := offset; i < end; i += 3 {
 		currRow := [3]bool{m[i] == 1, m[i+1] == 1, m[i+2] == 1}
 		elevatorState.request = append(elevatorState.request, currRow)
 	}
@@ -56,6 +101,22 @@ func deserialize(m []byte) *elevatorState {
 	return elevatorState
 }
 
+// Reports whether `o` describes the same state as `s`, apart from its identity and timing.
+func (s *elevatorState) sameAs(o *elevatorState) bool {
+	if o == nil || s.currFloor != o.currFloor || s.currDirection != o.currDirection ||
+		s.availability != o.availability || s.behaviour != o.behaviour || s.doorOpen != o.doorOpen ||
+		s.obstructed != o.obstructed || s.betweenFloors != o.betweenFloors || s.capacity != o.capacity ||
+		len(s.request) != len(o.request) {
+		return false
+	}
+	for i := range s.request {
+		if s.request[i] != o.request[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Gets the ID of the elevator.
 func (e *elevatorState) GetID() int {
 	return int(e.id)
@@ -71,6 +132,36 @@ func (e *elevatorState) GetDirection() elevio.MotorDirection {
 	return e.currDirection
 }
 
+// Gets the availability of the elevator for hall calls.
+func (e *elevatorState) GetAvailability() types.Availability {
+	return e.availability
+}
+
+// Gets the behaviour of the control loop of the elevator.
+func (e *elevatorState) GetBehaviour() types.Behaviour {
+	return e.behaviour
+}
+
+// Reports whether the door of the elevator is open.
+func (e *elevatorState) IsDoorOpen() bool {
+	return e.doorOpen
+}
+
+// Reports whether the door of the elevator is obstructed.
+func (e *elevatorState) IsObstructed() bool {
+	return e.obstructed
+}
+
+// Reports whether the car is between floors.
+func (e *elevatorState) IsBetweenFloors() bool {
+	return e.betweenFloors
+}
+
+// Gets the number of passengers the car takes, 0 if unknown.
+func (e *elevatorState) GetCapacity() int {
+	return e.capacity
+}
+
 // Gets the requests of the elevator.
 func (e *elevatorState) GetRequests() [][3]bool {
 	requestsCopy := make([][3]bool, len(e.request))
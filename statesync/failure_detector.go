@@ -0,0 +1,86 @@
+package statesync
+
+import (
+	"math"
+	"time"
+)
+
+// FailureDetectorConfig configures the phi accrual failure detector. Phi expresses the confidence
+// that an elevator failed given the heartbeat inter-arrival times observed so far: a phi of 1
+// means a 10% chance that the next heartbeat is still on its way, a phi of 2 means 1% and so on.
+type FailureDetectorConfig struct {
+	SuspectThreshold         float64       // phi at which an elevator is suspected
+	FailureThreshold         float64       // phi at which a failure is confirmed and orders are reassigned
+	MaxSampleSize            int           // number of inter-arrival times remembered per elevator
+	MinStdDeviation          time.Duration // lower bound of the deviation, avoids over-sensitivity on perfect networks
+	AcceptableHeartbeatPause time.Duration // silence tolerated on top of the observed inter-arrival times
+	FirstHeartbeatEstimate   time.Duration // assumed inter-arrival time before samples are available
+}
+
+// DefaultFailureDetectorConfig detects a crashed elevator within roughly 800ms on a healthy network
+// and adapts to longer, more varying inter-arrival times on lossy ones.
+var DefaultFailureDetectorConfig = FailureDetectorConfig{
+	SuspectThreshold:         4,
+	FailureThreshold:         12,
+	MaxSampleSize:            200,
+	MinStdDeviation:          50 * time.Millisecond,
+	AcceptableHeartbeatPause: 400 * time.Millisecond,
+	FirstHeartbeatEstimate:   heartbeatInterval,
+}
+
+// arrivalWindow keeps the most recent heartbeat inter-arrival times of one elevator.
+type arrivalWindow struct {
+	intervals   []time.Duration
+	next        int
+	lastArrival time.Time
+}
+
+func newArrivalWindow(now time.Time, cfg FailureDetectorConfig) *arrivalWindow {
+	w := &arrivalWindow{intervals: make([]time.Duration, 0, cfg.MaxSampleSize), lastArrival: now}
+
+	// Bootstrap with a guessed mean and deviation until real samples arrive.
+	estimate := cfg.FirstHeartbeatEstimate
+	w.push(estimate-estimate/4, cfg)
+	w.push(estimate+estimate/4, cfg)
+	return w
+}
+
+// add records a heartbeat arriving at `now`.
+func (w *arrivalWindow) add(now time.Time, cfg FailureDetectorConfig) {
+	w.push(now.Sub(w.lastArrival), cfg)
+	w.lastArrival = now
+}
+
+func (w *arrivalWindow) push(interval time.Duration, cfg FailureDetectorConfig) {
+	if len(w.intervals) < cfg.MaxSampleSize {
+		w.intervals = append(w.intervals, interval)
+		return
+	}
+	w.intervals[w.next] = interval
+	w.next = (w.next + 1) % len(w.intervals)
+}
+
+// phi returns the suspicion level at `now` given the time since the last heartbeat.
+func (w *arrivalWindow) phi(now time.Time, cfg FailureDetectorConfig) float64 {
+	var sum, squareSum float64
+	for _, interval := range w.intervals {
+		ms := float64(interval) / float64(time.Millisecond)
+		sum += ms
+		squareSum += ms * ms
+	}
+	n := float64(len(w.intervals))
+	mean := sum / n
+	stdDeviation := math.Sqrt(math.Max(squareSum/n-mean*mean, 0))
+	stdDeviation = math.Max(stdDeviation, float64(cfg.MinStdDeviation)/float64(time.Millisecond))
+	mean += float64(cfg.AcceptableHeartbeatPause) / float64(time.Millisecond)
+
+	elapsed := float64(now.Sub(w.lastArrival)) / float64(time.Millisecond)
+
+	// Logistic approximation of the cumulative normal distribution.
+	y := (elapsed - mean) / stdDeviation
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1 + e))
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
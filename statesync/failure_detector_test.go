@@ -0,0 +1,66 @@
+package statesync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailureDetector_PhiGrowsWithSilence(t *testing.T) {
+	cfg := DefaultFailureDetectorConfig
+	start := time.Now()
+	w := newArrivalWindow(start, cfg)
+	now := start
+	for range 100 {
+		now = now.Add(heartbeatInterval)
+		w.add(now, cfg)
+	}
+
+	prev := w.phi(now, cfg)
+	for silence := 100 * time.Millisecond; silence <= time.Second; silence += 100 * time.Millisecond {
+		phi := w.phi(now.Add(silence), cfg)
+		if phi < prev {
+			t.Errorf("Phi decreased from %.2f to %.2f after %v of silence", prev, phi, silence)
+		}
+		prev = phi
+	}
+	if prev < cfg.FailureThreshold {
+		t.Errorf("Expected failure after a second of silence, phi was %.2f", prev)
+	}
+}
+
+func TestFailureDetector_AdaptsToLossyNetwork(t *testing.T) {
+	cfg := DefaultFailureDetectorConfig
+	start := time.Now()
+	steady := newArrivalWindow(start, cfg)
+	lossy := newArrivalWindow(start, cfg)
+
+	steadyNow, lossyNow := start, start
+	for i := range 200 {
+		steadyNow = steadyNow.Add(heartbeatInterval)
+		steady.add(steadyNow, cfg)
+
+		// every other heartbeat is lost, and every tenth time a burst of ten
+		gap := heartbeatInterval * time.Duration(1+i%2)
+		if i%10 == 9 {
+			gap = 10 * heartbeatInterval
+		}
+		lossyNow = lossyNow.Add(gap)
+		lossy.add(lossyNow, cfg)
+	}
+
+	detectionTime := func(w *arrivalWindow, last time.Time) time.Duration {
+		silence := time.Duration(0)
+		for w.phi(last.Add(silence), cfg) < cfg.FailureThreshold {
+			silence += 10 * time.Millisecond
+		}
+		return silence
+	}
+
+	steadyDetection, lossyDetection := detectionTime(steady, steadyNow), detectionTime(lossy, lossyNow)
+	if lossyDetection <= steadyDetection {
+		t.Errorf("Expected more patience on lossy network, steady %v, lossy %v", steadyDetection, lossyDetection)
+	}
+	if steadyDetection > time.Second {
+		t.Errorf("Expected failure detection within a second on steady network, was %v", steadyDetection)
+	}
+}
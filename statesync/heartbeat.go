@@ -0,0 +1,101 @@
+package statesync
+
+import (
+	"elevator/types"
+	"encoding/binary"
+)
+
+type messageType uint8
+
+// The layout of a message type never changes, so elevators of different versions understand each
+// other. New fields get a new message type instead.
+const (
+	msgHeartbeat messageType = 0
+	msgState     messageType = 1 // legacy state without availability, behaviour and door
+	msgStateV2   messageType = 2
+	msgLeave     messageType = 3
+)
+
+const heartbeatLength = 11
+const leaveLength = 6
+const legacyStateHeaderLength = 12
+const stateHeaderLength = 17
+
+// heartbeat is the lightweight liveness message of an elevator. Unlike the full state it is
+// always sent, so peers can tell a degraded elevator apart from a failed one.
+type heartbeat struct {
+	id           int
+	incarnation  uint32
+	nonce        int
+	availability types.Availability
+}
+
+// Serializes a heartbeat into a byte slice.
+func serializeHeartbeat(h heartbeat) []byte {
+	buf := make([]byte, 0, 16)
+
+	buf = append(buf, byte(msgHeartbeat))
+	buf = append(buf, uint8(h.id))
+	buf = binary.LittleEndian.AppendUint32(buf, h.incarnation)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(h.nonce))
+	buf = append(buf, byte(h.availability))
+
+	return buf
+}
+
+// Deserializes a byte slice into a heartbeat.
+func deserializeHeartbeat(m []byte) heartbeat {
+	return heartbeat{
+		id:           int(m[1]),
+		incarnation:  binary.LittleEndian.Uint32(m[2:6]),
+		nonce:        int(binary.LittleEndian.Uint32(m[6:10])),
+		availability: types.Availability(m[10]),
+	}
+}
+
+// leave announces that an elevator stops for good, so peers take over its hall calls at once
+// instead of waiting for the failure detector. Its incarnation tells it apart from a restart.
+type leave struct {
+	id          int
+	incarnation uint32
+}
+
+// Serializes a leave message into a byte slice.
+func serializeLeave(l leave) []byte {
+	buf := make([]byte, 0, leaveLength)
+
+	buf = append(buf, byte(msgLeave))
+	buf = append(buf, uint8(l.id))
+	buf = binary.LittleEndian.AppendUint32(buf, l.incarnation)
+
+	return buf
+}
+
+// Deserializes a byte slice into a leave message.
+func deserializeLeave(m []byte) leave {
+	return leave{
+		id:          int(m[1]),
+		incarnation: binary.LittleEndian.Uint32(m[2:6]),
+	}
+}
+
+// Reports whether `m` can be decoded as a heartbeat, state or leave message of an elevator with
+// `numFloors` floors. States with any number of floors are accepted if `numFloors` is 0.
+func wellFormed(m []byte, numFloors int) bool {
+	if len(m) == 0 {
+		return false
+	}
+	fits := func(rows int) bool { return numFloors == 0 || rows == numFloors }
+	switch messageType(m[0]) {
+	case msgHeartbeat:
+		return len(m) == heartbeatLength
+	case msgLeave:
+		return len(m) == leaveLength
+	case msgState:
+		return len(m) >= legacyStateHeaderLength && (len(m)-legacyStateHeaderLength)%3 == 0 &&
+			fits((len(m)-legacyStateHeaderLength)/3)
+	case msgStateV2:
+		return len(m) >= stateHeaderLength && len(m) >= stateHeaderLength+3*int(m[16]) && fits(int(m[16]))
+	}
+	return false
+}
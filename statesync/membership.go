@@ -0,0 +1,313 @@
+package statesync
+
+import (
+	"elevator/types"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+type MemberStatus int
+
+const (
+	MS_Alive   MemberStatus = 0
+	MS_Suspect MemberStatus = 1
+	MS_Left    MemberStatus = 2
+)
+
+type MemberEventType int
+
+const (
+	ME_Join    MemberEventType = 0 // first message of an elevator
+	ME_Leave   MemberEventType = 1 // failure confirmed by the failure detector, its orders got reassigned
+	ME_Suspect MemberEventType = 2 // suspected by the failure detector, its orders are kept until confirmed
+	ME_Rejoin  MemberEventType = 3 // heard again after suspect or leave, or restarted with a new incarnation
+	ME_Depart  MemberEventType = 4 // announced leaving, its orders got reassigned at once
+)
+
+// MemberEvent reports a change in the membership of elevator `ElevatorID`.
+type MemberEvent struct {
+	Type        MemberEventType
+	ElevatorID  int
+	Incarnation uint32
+}
+
+// Member describes an elevator as seen by the membership at one instant.
+type Member struct {
+	ID           int
+	Incarnation  uint32
+	Status       MemberStatus
+	Availability types.Availability
+	Phi          float64 // suspicion level at the last check
+	JoinedAt     time.Time
+	LastSeen     time.Time
+
+	heartbeats       *arrivalWindow
+	unavailableSince time.Time
+	handedOver       bool
+	healed           bool
+	departed         bool // announced leaving with its current incarnation
+	synced           bool // a state of its current incarnation was accepted
+}
+
+func (s MemberStatus) String() string {
+	switch s {
+	case MS_Alive:
+		return "alive"
+	case MS_Suspect:
+		return "suspect"
+	case MS_Left:
+		return "left"
+	}
+	return fmt.Sprintf("MemberStatus(%d)", int(s))
+}
+
+func (t MemberEventType) String() string {
+	switch t {
+	case ME_Join:
+		return "join"
+	case ME_Leave:
+		return "leave"
+	case ME_Suspect:
+		return "suspect"
+	case ME_Rejoin:
+		return "rejoin"
+	case ME_Depart:
+		return "depart"
+	}
+	return fmt.Sprintf("MemberEventType(%d)", int(t))
+}
+
+// membership tracks which elevators are alive. An elevator picks a new incarnation number on every
+// start, which lets peers recognise a restart even though its message nonce starts from zero again.
+type membership struct {
+	selfID  int
+	cfg     FailureDetectorConfig
+	members map[int]*Member
+}
+
+func newMembership(selfID int, cfg FailureDetectorConfig) *membership {
+	return &membership{selfID: selfID, cfg: cfg, members: make(map[int]*Member)}
+}
+
+// observe records a message of elevator `id` with `incarnation` received at `now`.
+// Messages of an older incarnation, or of an incarnation which announced leaving and was only
+// still underway, are ignored and reported as not accepted.
+func (m *membership) observe(id int, incarnation uint32, now time.Time) (accepted bool, events []MemberEvent) {
+	member, exists := m.members[id]
+	if !exists {
+		m.members[id] = &Member{ID: id, Incarnation: incarnation, Status: MS_Alive, JoinedAt: now, LastSeen: now}
+		return true, []MemberEvent{{ME_Join, id, incarnation}}
+	}
+	if incarnation < member.Incarnation || (incarnation == member.Incarnation && member.departed) {
+		return false, nil
+	}
+
+	rejoined := incarnation > member.Incarnation || member.Status != MS_Alive
+	if incarnation == member.Incarnation && member.Status == MS_Left {
+		// Same incarnation after a confirmed failure: the network was partitioned and healed.
+		member.healed = true
+	}
+	if incarnation > member.Incarnation {
+		member.synced = false
+	}
+	if incarnation > member.Incarnation || member.Status == MS_Left {
+		member.JoinedAt = now
+		member.heartbeats = nil
+		member.departed = false
+	}
+	member.Incarnation = incarnation
+	member.Status = MS_Alive
+	member.LastSeen = now
+
+	if rejoined {
+		return true, []MemberEvent{{ME_Rejoin, id, incarnation}}
+	}
+	return true, nil
+}
+
+// depart records that elevator `id` announced leaving with `incarnation` at `now`. It is no
+// longer alive, so the failure detector skips it. Leave messages of an older incarnation and
+// repetitions are ignored and reported as not accepted. Also reports whether its hall calls were
+// handed over already because it was out of service.
+func (m *membership) depart(id int, incarnation uint32, now time.Time) (accepted bool, events []MemberEvent, handedOver bool) {
+	member, exists := m.members[id]
+	if !exists || incarnation < member.Incarnation || (incarnation == member.Incarnation && member.departed) {
+		return false, nil, false
+	}
+	if member.Status != MS_Left {
+		events = []MemberEvent{{ME_Depart, id, incarnation}}
+	}
+	handedOver = incarnation == member.Incarnation && member.handedOver
+	member.Incarnation = incarnation
+	member.Status = MS_Left
+	member.LastSeen = now
+	member.heartbeats = nil
+	member.departed = true
+	return true, events, handedOver
+}
+
+// takeHealed reports whether elevator `id` rejoined after a partition since the last call.
+// Both sides of the partition might have taken over the same hall calls in the meantime.
+func (m *membership) takeHealed(id int) bool {
+	member, exists := m.members[id]
+	if !exists || !member.healed {
+		return false
+	}
+	member.healed = false
+	return true
+}
+
+// heartbeat feeds the failure detector of elevator `id` with a heartbeat arriving at `now`.
+// Must be called after `observe` accepted the heartbeat.
+func (m *membership) heartbeat(id int, now time.Time) {
+	member, exists := m.members[id]
+	if !exists {
+		return
+	}
+	if member.heartbeats == nil {
+		member.heartbeats = newArrivalWindow(now, m.cfg)
+		return
+	}
+	member.heartbeats.add(now, m.cfg)
+}
+
+// setAvailability records the availability advertised by elevator `id` at `now`.
+func (m *membership) setAvailability(id int, availability types.Availability, now time.Time) {
+	member, exists := m.members[id]
+	if !exists || member.Availability == availability {
+		return
+	}
+	if member.Availability == types.AV_Available {
+		member.unavailableSince = now
+	}
+	if availability == types.AV_Available {
+		member.handedOver = false
+	}
+	member.Availability = availability
+}
+
+// stateAccepted records that a state of the current incarnation of elevator `id` was accepted.
+func (m *membership) stateAccepted(id int) {
+	if member, exists := m.members[id]; exists {
+		member.synced = true
+	}
+}
+
+// check suspects and removes elevators whose suspicion level at `now` exceeds the thresholds.
+// Returns the membership events, the IDs of elevators which left and the IDs of alive elevators
+// whose hall calls must be handed over because they are out of service or have been degraded
+// for longer than `syncTimeout`.
+func (m *membership) check(now time.Time) (events []MemberEvent, left []int, handover []int) {
+	for _, id := range m.ids() {
+		member := m.members[id]
+		if id == m.selfID || member.Status == MS_Left {
+			continue
+		}
+
+		member.Phi = m.phi(member, now)
+		if member.Phi >= m.cfg.FailureThreshold {
+			member.Status = MS_Left
+			events = append(events, MemberEvent{ME_Leave, id, member.Incarnation})
+			left = append(left, id)
+			continue
+		} else if member.Phi >= m.cfg.SuspectThreshold && member.Status == MS_Alive {
+			member.Status = MS_Suspect
+			events = append(events, MemberEvent{ME_Suspect, id, member.Incarnation})
+		}
+
+		if member.Availability != types.AV_Available && !member.handedOver &&
+			(member.Availability == types.AV_OutOfService || now.Sub(member.unavailableSince) > syncTimeout) {
+			member.handedOver = true
+			handover = append(handover, id)
+		}
+	}
+	return events, left, handover
+}
+
+// Returns the suspicion level of `member` at `now`. Elevators which never sent a heartbeat
+// are considered failed once they have been silent for `syncTimeout`.
+func (m *membership) phi(member *Member, now time.Time) float64 {
+	if member.heartbeats == nil {
+		if now.Sub(member.LastSeen) > syncTimeout {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return member.heartbeats.phi(now, m.cfg)
+}
+
+// leaveAll declares every other elevator failed, e.g. because we lost the network.
+// Returns the membership events and the IDs of elevators which left.
+func (m *membership) leaveAll() (events []MemberEvent, left []int) {
+	for _, id := range m.ids() {
+		member := m.members[id]
+		if id == m.selfID || member.Status == MS_Left {
+			continue
+		}
+		member.Status = MS_Left
+		events = append(events, MemberEvent{ME_Leave, id, member.Incarnation})
+		left = append(left, id)
+	}
+	return events, left
+}
+
+// availability returns the availability last advertised by elevator `id`. Elevators which are not
+// alive, or none of whose states was accepted yet, are out of service.
+func (m *membership) availability(id int) types.Availability {
+	if !m.isAlive(id) {
+		return types.AV_OutOfService
+	}
+	if member, exists := m.members[id]; exists {
+		if !member.synced && id != m.selfID {
+			return types.AV_OutOfService
+		}
+		return member.Availability
+	}
+	return types.AV_Available
+}
+
+// isAlive reports whether elevator `id` is alive or only suspected to have failed.
+func (m *membership) isAlive(id int) bool {
+	if id == m.selfID {
+		return true
+	}
+	member, exists := m.members[id]
+	return exists && member.Status != MS_Left
+}
+
+// aliveIDs returns the sorted IDs of all alive elevators, always including this one.
+func (m *membership) aliveIDs() []int {
+	alive := make([]int, 0, len(m.members)+1)
+	if _, exists := m.members[m.selfID]; !exists {
+		alive = append(alive, m.selfID)
+	}
+	for _, id := range m.ids() {
+		if m.isAlive(id) {
+			alive = append(alive, id)
+		}
+	}
+	sort.Ints(alive)
+	return alive
+}
+
+// snapshot returns copies of all known members sorted by ID, without their heartbeat history.
+func (m *membership) snapshot() []Member {
+	members := make([]Member, 0, len(m.members))
+	for _, id := range m.ids() {
+		member := *m.members[id]
+		member.heartbeats = nil
+		members = append(members, member)
+	}
+	return members
+}
+
+func (m *membership) ids() []int {
+	ids := make([]int, 0, len(m.members))
+	for id := range m.members {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
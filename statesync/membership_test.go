@@ -0,0 +1,185 @@
+package statesync
+
+import (
+	"elevator/types"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Sends heartbeats of elevator `id` every `interval` for `count` times starting at `start`.
+// Returns the time of the last heartbeat.
+func sendHeartbeats(m *membership, id int, start time.Time, interval time.Duration, count int) time.Time {
+	now := start
+	for i := range count {
+		now = start.Add(time.Duration(i) * interval)
+		m.observe(id, 7, now)
+		m.heartbeat(id, now)
+	}
+	return now
+}
+
+func TestMembership_JoinSuspectLeaveRejoin(t *testing.T) {
+	m := newMembership(0, DefaultFailureDetectorConfig)
+	start := time.Now()
+
+	_, events := m.observe(1, 7, start)
+	expectEvents(t, events, []MemberEvent{{ME_Join, 1, 7}})
+	last := sendHeartbeats(m, 1, start, heartbeatInterval, 100)
+
+	var suspectedAfter, leftAfter time.Duration
+	for silence := time.Duration(0); silence < syncTimeout && leftAfter == 0; silence += monitorInterval {
+		events, left, _ := m.check(last.Add(silence))
+		for _, event := range events {
+			if event.Type == ME_Suspect {
+				suspectedAfter = silence
+				if len(left) != 0 || !m.isAlive(1) {
+					t.Errorf("Suspected elevator must still count as alive")
+				}
+			}
+			if event.Type == ME_Leave {
+				leftAfter = silence
+				if !reflect.DeepEqual(left, []int{1}) || m.isAlive(1) {
+					t.Errorf("Expected elevator 1 to leave, left: %v", left)
+				}
+			}
+		}
+	}
+	if suspectedAfter == 0 || leftAfter == 0 || suspectedAfter > leftAfter {
+		t.Fatalf("Expected suspicion before failure, suspected after %v, left after %v", suspectedAfter, leftAfter)
+	}
+	if leftAfter > time.Second {
+		t.Errorf("Expected failure detection within a second on a healthy network, was %v", leftAfter)
+	}
+
+	_, events = m.observe(1, 7, last.Add(syncTimeout))
+	expectEvents(t, events, []MemberEvent{{ME_Rejoin, 1, 7}})
+	if !reflect.DeepEqual(m.aliveIDs(), []int{0, 1}) {
+		t.Errorf("Expected elevators 0 and 1 alive, was %v", m.aliveIDs())
+	}
+}
+
+func TestMembership_RestartIsRecognised(t *testing.T) {
+	m := newMembership(0, DefaultFailureDetectorConfig)
+	start := time.Now()
+
+	m.observe(1, 7, start)
+	accepted, events := m.observe(1, 8, start.Add(time.Second))
+	if !accepted {
+		t.Errorf("Expected message of newer incarnation to be accepted")
+	}
+	expectEvents(t, events, []MemberEvent{{ME_Rejoin, 1, 8}})
+
+	accepted, _ = m.observe(1, 7, start.Add(time.Second))
+	if accepted {
+		t.Errorf("Expected message of older incarnation to be ignored")
+	}
+}
+
+func TestMembership_SelfNeverFails(t *testing.T) {
+	m := newMembership(2, DefaultFailureDetectorConfig)
+	events, left, _ := m.check(time.Now().Add(time.Hour))
+	if len(events) != 0 || len(left) != 0 || !reflect.DeepEqual(m.aliveIDs(), []int{2}) {
+		t.Errorf("Expected only self to be alive, was %v", m.aliveIDs())
+	}
+}
+
+func expectEvents(t *testing.T, events, expected []MemberEvent) {
+	t.Helper()
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Membership events not as expected.\nExpected: %+v\nWas: %+v", expected, events)
+	}
+}
+
+func TestMembership_HandoverOfUnavailableElevators(t *testing.T) {
+	m := newMembership(0, DefaultFailureDetectorConfig)
+	start := time.Now()
+	m.observe(1, 1, start)
+	m.observe(2, 1, start)
+	m.heartbeat(1, start)
+	m.heartbeat(2, start)
+
+	m.setAvailability(1, types.AV_OutOfService, start)
+	m.setAvailability(2, types.AV_Degraded, start)
+
+	_, _, handover := m.check(start)
+	if !reflect.DeepEqual(handover, []int{1}) {
+		t.Errorf("Expected immediate handover of out of service elevator, was %v", handover)
+	}
+
+	later := start.Add(syncTimeout + time.Millisecond)
+	sendHeartbeats(m, 1, start, heartbeatInterval, int(syncTimeout/heartbeatInterval)+1)
+	sendHeartbeats(m, 2, start, heartbeatInterval, int(syncTimeout/heartbeatInterval)+1)
+	_, _, handover = m.check(later)
+	if !reflect.DeepEqual(handover, []int{2}) {
+		t.Errorf("Expected handover of elevator degraded for too long, was %v", handover)
+	}
+	if !m.isAlive(1) || !m.isAlive(2) {
+		t.Errorf("Unavailable elevators must still count as alive")
+	}
+}
+
+func TestMembership_UnavailableUntilStateAccepted(t *testing.T) {
+	m := newMembership(0, DefaultFailureDetectorConfig)
+	start := time.Now()
+	m.observe(1, 7, start)
+	m.setAvailability(1, types.AV_Available, start)
+	if a := m.availability(1); a != types.AV_OutOfService {
+		t.Errorf("Expected elevator without accepted state to be out of service, was %v", a)
+	}
+
+	m.stateAccepted(1)
+	if a := m.availability(1); a != types.AV_Available {
+		t.Errorf("Expected elevator with accepted state to be available, was %v", a)
+	}
+
+	m.observe(1, 8, start.Add(time.Second))
+	if a := m.availability(1); a != types.AV_OutOfService {
+		t.Errorf("Expected restarted elevator to be out of service until its state is accepted, was %v", a)
+	}
+}
+
+func TestMembership_PartitionHealIsRecognised(t *testing.T) {
+	m := newMembership(0, DefaultFailureDetectorConfig)
+	start := time.Now()
+	m.observe(1, 7, start)
+	m.observe(2, 7, start)
+
+	m.check(start.Add(2 * syncTimeout))
+	m.observe(1, 7, start.Add(3*syncTimeout))
+	m.observe(2, 8, start.Add(3*syncTimeout))
+
+	if !m.takeHealed(1) || m.takeHealed(1) {
+		t.Errorf("Expected heal of elevator 1 to be reported exactly once")
+	}
+	if m.takeHealed(2) {
+		t.Errorf("Expected restart of elevator 2 not to be reported as heal")
+	}
+}
+
+func TestMembership_Depart(t *testing.T) {
+	m := newMembership(0, DefaultFailureDetectorConfig)
+	start := time.Now()
+	last := sendHeartbeats(m, 1, start, heartbeatInterval, 20)
+
+	accepted, events, handedOver := m.depart(1, 7, last)
+	expectEvents(t, events, []MemberEvent{{ME_Depart, 1, 7}})
+	if !accepted || handedOver || m.isAlive(1) {
+		t.Fatalf("Expected elevator 1 to depart, accepted: %v, handed over: %v", accepted, handedOver)
+	}
+	if accepted, _, _ := m.depart(1, 7, last); accepted {
+		t.Errorf("Expected repeated leave message to be ignored")
+	}
+	if accepted, _ := m.observe(1, 7, last.Add(time.Millisecond)); accepted || m.isAlive(1) {
+		t.Errorf("Expected heartbeat sent before leaving to be ignored")
+	}
+	if events, left, _ := m.check(last.Add(2 * syncTimeout)); len(events) != 0 || len(left) != 0 {
+		t.Errorf("Expected the failure detector to skip the departed elevator, was %v", events)
+	}
+
+	_, events = m.observe(1, 8, last.Add(time.Second))
+	expectEvents(t, events, []MemberEvent{{ME_Rejoin, 1, 8}})
+	if !m.isAlive(1) {
+		t.Errorf("Expected elevator 1 to rejoin after a restart")
+	}
+}
@@ -0,0 +1,41 @@
+package statesync
+
+import (
+	"elevator/metrics"
+	"strconv"
+)
+
+// syncMetrics are the metrics of the state sync of one elevator, labelled with its ID since several
+// elevators may run in one process.
+type syncMetrics struct {
+	heartbeatsSent     *metrics.Counter
+	statesSent         *metrics.Counter
+	leavesSent         *metrics.Counter
+	heartbeatsReceived *metrics.Counter
+	statesReceived     *metrics.Counter
+	leavesReceived     *metrics.Counter
+	messagesDropped    *metrics.Counter
+	messagesMalformed  *metrics.Counter
+	peerFailures       *metrics.Counter
+	peerDepartures     *metrics.Counter
+	changesCoalesced   *metrics.Counter
+	reassignedOrders   *metrics.Counter
+}
+
+func newSyncMetrics(elevatorID int) *syncMetrics {
+	id := strconv.Itoa(elevatorID)
+	return &syncMetrics{
+		heartbeatsSent:     metrics.NewCounter("elevator_statesync_messages_sent_total", "State sync messages sent.", "elevator", id, "type", "heartbeat"),
+		statesSent:         metrics.NewCounter("elevator_statesync_messages_sent_total", "State sync messages sent.", "elevator", id, "type", "state"),
+		leavesSent:         metrics.NewCounter("elevator_statesync_messages_sent_total", "State sync messages sent.", "elevator", id, "type", "leave"),
+		heartbeatsReceived: metrics.NewCounter("elevator_statesync_messages_received_total", "State sync messages received.", "elevator", id, "type", "heartbeat"),
+		statesReceived:     metrics.NewCounter("elevator_statesync_messages_received_total", "State sync messages received.", "elevator", id, "type", "state"),
+		leavesReceived:     metrics.NewCounter("elevator_statesync_messages_received_total", "State sync messages received.", "elevator", id, "type", "leave"),
+		messagesDropped:    metrics.NewCounter("elevator_statesync_messages_dropped_total", "State sync messages ignored because they were outdated.", "elevator", id),
+		messagesMalformed:  metrics.NewCounter("elevator_statesync_messages_malformed_total", "State sync messages which could not be decoded.", "elevator", id),
+		peerFailures:       metrics.NewCounter("elevator_statesync_peer_failures_total", "Failures of other elevators confirmed by the failure detector.", "elevator", id),
+		peerDepartures:     metrics.NewCounter("elevator_statesync_peer_departures_total", "Other elevators which announced leaving.", "elevator", id),
+		changesCoalesced:   metrics.NewCounter("elevator_statesync_changes_coalesced_total", "Changes of elevator states never delivered to lagging subscribers since later changes superseded them.", "elevator", id),
+		reassignedOrders:   metrics.NewCounter("elevator_statesync_reassigned_orders_total", "Hall calls taken over from failed, departed, restarted or unavailable elevators.", "elevator", id),
+	}
+}
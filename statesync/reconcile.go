@@ -0,0 +1,24 @@
+package statesync
+
+import "elevator/elevio"
+
+// duplicateHallCalls returns the hall calls in `mine` which elevator `peerID` also holds in
+// `theirs` and which we, elevator `selfID`, must give up. Of all elevators holding the same
+// hall call the one with the lowest ID keeps it, so both sides of a healed partition agree on
+// the owner without further messages. Cab calls are never touched.
+func duplicateHallCalls(selfID int, mine [][3]bool, peerID int, theirs [][3]bool) []elevio.ButtonEvent {
+	if peerID > selfID {
+		return nil
+	}
+
+	duplicates := make([]elevio.ButtonEvent, 0)
+	btns := [...]elevio.ButtonType{elevio.BT_HallUp, elevio.BT_HallDown}
+	for floor := 0; floor < len(mine) && floor < len(theirs); floor++ {
+		for _, btn := range btns {
+			if mine[floor][btn] && theirs[floor][btn] {
+				duplicates = append(duplicates, elevio.ButtonEvent{Floor: floor, Button: btn})
+			}
+		}
+	}
+	return duplicates
+}
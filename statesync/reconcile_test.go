@@ -0,0 +1,28 @@
+package statesync
+
+import (
+	"elevator/elevio"
+	"reflect"
+	"testing"
+)
+
+func TestReconcile_HigherIDGivesUpDuplicates(t *testing.T) {
+	mine := [][3]bool{{true, false, true}, {false, true, false}, {false, false, true}}
+	theirs := [][3]bool{{true, false, false}, {false, false, false}, {false, true, true}}
+
+	result := duplicateHallCalls(2, mine, 1, theirs)
+	expected := []elevio.ButtonEvent{{Floor: 0, Button: elevio.BT_HallUp}}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Duplicates not as expected.\nExpected: %+v\nWas: %+v", expected, result)
+	}
+}
+
+func TestReconcile_LowerIDKeepsDuplicates(t *testing.T) {
+	mine := [][3]bool{{true, true, false}, {false, true, false}}
+	theirs := [][3]bool{{true, true, false}, {false, true, false}}
+
+	if result := duplicateHallCalls(0, mine, 1, theirs); len(result) != 0 {
+		t.Errorf("Expected lowest ID to keep all hall calls, was told to drop %+v", result)
+	}
+}
@@ -1,106 +1,201 @@
 package statesync
 
 import (
+	"context"
+	"elevator/clock"
 	"elevator/elevio"
+	"elevator/logging"
+	"elevator/transport"
 	"elevator/types"
-	"fmt"
-	"log"
-	"net"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const broadcastAddr = "255.255.255.255"
-const broadcastPort = "49234"
-const interval = 25 * time.Millisecond
+// BroadcastPort is the port heartbeats and states are broadcast on.
+const BroadcastPort = "49234"
+const heartbeatInterval = 25 * time.Millisecond
+const stateRefreshInterval = 250 * time.Millisecond
 const syncTimeout = 3 * time.Second
+const monitorInterval = 50 * time.Millisecond
+const leaveRepetitions = 3 // leave messages sent on leaving, since any of them may be lost
 
-var _initialized bool
-var _mtx sync.RWMutex
-var _states = make([]*elevatorState, 0, 10)
-var _elevatorID int
-var _heartbeatDisabled bool = false
+var _log = logging.For("statesync")
 
-// Init start continuously broadcasting the state of the initialized elevator and receiving
-// states of other elevators and maintains a set of alive elevators.
-// Use `GetAliveElevatorIDs` and `GetState` to obtain live elevators.
-func Init(elevator types.ElevatorState, reassignmentChan chan elevio.ButtonEvent, errorChan chan string) {
-	if _initialized {
-		fmt.Println("assigner already initialized!")
-		return
-	}
+// Incarnations count `incarnationResolution` ticks since `incarnationEpoch` above 2^31, so they
+// exceed the Unix seconds older versions picked and stay ordered until 2054.
+var incarnationEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
 
-	_elevatorID = elevator.GetID()
+const incarnationResolution = 500 * time.Millisecond
 
-	go func() { //Check every second
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
+// lastIncarnation is the incarnation picked last in this process, as an elevator restarted within
+// one tick must still pick a greater incarnation.
+var lastIncarnation atomic.Uint32
 
-		for range ticker.C {
-			ElevatorStuck(elevator, errorChan)
+// Returns an incarnation for an elevator starting at `now`, greater than any picked in this
+// process before.
+func newIncarnation(now time.Time) uint32 {
+	ticks := min(max(now.Sub(incarnationEpoch), 0)/incarnationResolution, 1<<31-1)
+	incarnation := uint32(1<<31 + ticks)
+	for {
+		last := lastIncarnation.Load()
+		next := max(incarnation, last+1)
+		if lastIncarnation.CompareAndSwap(last, next) {
+			return next
 		}
-	}()
-
-	go broadcastState(elevator)
-	go receiveStates()
-	go monitorFailedSyncs(reassignmentChan)
+	}
+}
 
-	_initialized = true
+// Sync broadcasts the state of one elevator and maintains the states and membership of all others.
+type Sync struct {
+	mtx            sync.RWMutex
+	states         []*elevatorState
+	elevatorID     int
+	elevator       types.ElevatorState
+	incarnation    uint32
+	members        *membership
+	detectorConfig FailureDetectorConfig
+	connectivity   connectivity
+	transport      transport.Transport
+	clock          clock.Clock
+	metrics        *syncMetrics
+
+	reassignmentChan chan elevio.ButtonEvent
+	unassignChan     chan elevio.ButtonEvent
+	memberChan       chan MemberEvent
+	subscribers      []*subscription
+	stopped          chan struct{} // closed once all goroutines returned
 }
 
-// EnableHeartbeat starts sending state messages to other elevators.
-func EnableHeartbeat() {
-	_mtx.Lock()
-	defer _mtx.Unlock()
+// New prepares the state sync of `elevator`. States are exchanged over `tr` and timed by `clk`.
+// Use `GetAliveElevatorIDs` and `GetState` to obtain live elevators.
+// Hall calls to take over from failed elevators are sent on `reassignmentChan`, hall calls we hold
+// twice after a healed partition and must give up are sent on `unassignChan`.
+// Changes in membership are published on `memberChan`. The availability of `elevator` is advertised
+// in every heartbeat and state, so peers take over our hall calls while we are not available but
+// keep seeing us alive.
+func New(elevator types.ElevatorState, tr transport.Transport, clk clock.Clock, reassignmentChan chan elevio.ButtonEvent,
+	unassignChan chan elevio.ButtonEvent, memberChan chan MemberEvent) *Sync {
+	return &Sync{
+		states:           make([]*elevatorState, 0, 10),
+		elevatorID:       elevator.GetID(),
+		elevator:         elevator,
+		incarnation:      newIncarnation(clk.Now()),
+		members:          newMembership(elevator.GetID(), DefaultFailureDetectorConfig),
+		detectorConfig:   DefaultFailureDetectorConfig,
+		transport:        tr,
+		clock:            clk,
+		metrics:          newSyncMetrics(elevator.GetID()),
+		reassignmentChan: reassignmentChan,
+		unassignChan:     unassignChan,
+		memberChan:       memberChan,
+		stopped:          make(chan struct{}),
+	}
+}
 
-	if _elevatorID < len(_states) && _states[_elevatorID] != nil {
-		_heartbeatDisabled = false
+// Start continuously broadcasting the state of the elevator and receiving states of other
+// elevators and maintains a set of alive elevators until `ctx` is done. The elevator then
+// broadcasts its last state and announces leaving, so peers take over its hall calls at once.
+// Subscriptions are closed once all goroutines returned.
+func (s *Sync) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, run := range []func(context.Context){s.broadcastState, s.receiveStates, s.monitorFailedSyncs} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx)
+		}()
 	}
+
+	go func() {
+		wg.Wait()
+		s.mtx.Lock()
+		for _, sub := range s.subscribers {
+			close(sub.done)
+		}
+		s.subscribers = nil
+		s.mtx.Unlock()
+		close(s.stopped)
+	}()
+}
+
+// Wait blocks until the state sync stopped after the context passed to `Start` was done.
+func (s *Sync) Wait() {
+	<-s.stopped
 }
 
-// DisableHeartbeat stops sending state messages to other elevators.
-func DisableHeartbeat() {
-	_mtx.Lock()
-	defer _mtx.Unlock()
+// ConfigureFailureDetector replaces the configuration of the failure detector.
+// May be called before or after `Start`.
+func (s *Sync) ConfigureFailureDetector(cfg FailureDetectorConfig) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 
-	if _elevatorID < len(_states) && _states[_elevatorID] != nil {
-		_heartbeatDisabled = true
+	s.detectorConfig = cfg
+	s.members.cfg = cfg
+}
+
+// GetAvailability of the elevator with `elevatorID`. Elevators which are not alive are out of service.
+func (s *Sync) GetAvailability(elevatorID int) types.Availability {
+	if elevatorID == s.elevatorID {
+		return s.elevator.GetAvailability()
 	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.members.availability(elevatorID)
 }
 
 // GetState of the elevator with `elevatorID`. Retruns nil if there's no up to date information.
-func GetState(elevatorID int) types.ElevatorState {
-	_mtx.RLock()
-	defer _mtx.RUnlock()
-	if elevatorID < len(_states) {
-		return _states[elevatorID]
+// States are never modified once received, so the state returned is a snapshot. Use `Snapshot`
+// to read the states of several elevators at one instant.
+func (s *Sync) GetState(elevatorID int) types.ElevatorState {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if elevatorID < len(s.states) && s.states[elevatorID] != nil {
+		return s.states[elevatorID]
 	}
 	return nil
 }
 
-// GetAliveElevatorIDs returns a slice of IDs of all elevators which have synced within the timeout.
-func GetAliveElevatorIDs() []int {
-	_mtx.RLock()
-	defer _mtx.RUnlock()
+// IsOffline reports whether this elevator lost the network entirely. While offline every other
+// elevator is considered failed and this elevator serves all hall calls on its own.
+func (s *Sync) IsOffline() bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
 
-	alive := make([]int, 0, len(_states))
+	return s.connectivity.offline
+}
 
-	for id, s := range _states {
-		if s != nil || id == _elevatorID {
-			alive = append(alive, id)
-		}
-	}
-	log.Printf("Alive elevators: %v", alive)
+// GetAliveElevatorIDs returns a slice of IDs of all elevators which have synced within the timeout.
+func (s *Sync) GetAliveElevatorIDs() []int {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	alive := s.members.aliveIDs()
+	_log.Debug("alive elevators", "alive", alive)
 	return alive
 }
 
+// GetMembers returns all elevators ever heard of with their membership status.
+func (s *Sync) GetMembers() []Member {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.members.snapshot()
+}
+
 // Or aggregates requests from all live elevators and `myRequests`.
-func GetOrAggregatedLiveRequests(myRequests [][3]bool) [][3]bool {
+func (s *Sync) GetOrAggregatedLiveRequests(myRequests [][3]bool) [][3]bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
 	aggMatrix := make([][3]bool, len(myRequests))
 	copy(aggMatrix, myRequests)
 
-	for _, state := range _states {
-		if state == nil {
+	for id, state := range s.states {
+		if state == nil || !s.members.isAlive(id) {
 			continue
 		}
 
@@ -113,104 +208,247 @@ func GetOrAggregatedLiveRequests(myRequests [][3]bool) [][3]bool {
 	return aggMatrix
 }
 
-// Broadcasts the elevator's state over UDP at regular intervals.
-func broadcastState(elevatorPtr types.ElevatorState) {
-	var conn net.Conn
+// Broadcasts a heartbeat at regular intervals and the elevator's state whenever it changes,
+// but at least every `stateRefreshInterval`.
+func (s *Sync) broadcastState(ctx context.Context) {
+	var conn io.WriteCloser
 
 	for {
 		var err error
-		addr := broadcastAddr + ":" + broadcastPort
-		conn, err = net.Dial("udp", addr)
+		conn, err = s.transport.Dial(BroadcastPort)
 		if err == nil {
 			break
 		}
-		time.Sleep(1 * time.Second)
+		if !clock.SleepContext(ctx, s.clock, 1*time.Second) {
+			return
+		}
 	}
 	defer conn.Close()
 
-	var myState elevatorState
+	var lastState *elevatorState
+	var lastStateSent time.Time
 	nonce := 0
 
-	ticker := time.NewTicker(interval)
+	ticker := s.clock.NewTicker(heartbeatInterval)
 	defer ticker.Stop()
-	for range ticker.C {
-		if _heartbeatDisabled {
-			continue
+	for {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C():
+		}
+		leaving := ctx.Err() != nil
+		if leaving {
+			lastState = nil // announce the state we leave in even if it did not change
+		}
+
+		myHeartbeat := heartbeat{
+			id:           s.elevatorID,
+			incarnation:  s.incarnation,
+			nonce:        nonce,
+			availability: s.elevator.GetAvailability(),
+		}
+		nonce++
+
+		_, err := conn.Write(serializeHeartbeat(myHeartbeat))
+		s.mtx.Lock()
+		s.connectivity.sent(err)
+		s.mtx.Unlock()
+		if err == nil {
+			s.metrics.heartbeatsSent.Inc()
 		}
-		myState.id = elevatorPtr.GetID()
-		myState.nonce = nonce
-		myState.currFloor = elevatorPtr.GetFloor()
-		myState.currDirection = elevatorPtr.GetDirection()
-		myState.request = elevatorPtr.GetRequests()
 
+		myState := &elevatorState{
+			id:            s.elevatorID,
+			incarnation:   s.incarnation,
+			nonce:         nonce,
+			currFloor:     s.elevator.GetFloor(),
+			currDirection: s.elevator.GetDirection(),
+			availability:  s.elevator.GetAvailability(),
+			behaviour:     s.elevator.GetBehaviour(),
+			doorOpen:      s.elevator.IsDoorOpen(),
+			obstructed:    s.elevator.IsObstructed(),
+			betweenFloors: s.elevator.IsBetweenFloors(),
+			capacity:      s.elevator.GetCapacity(),
+			request:       s.elevator.GetRequests(),
+		}
+		if myState.sameAs(lastState) && s.clock.Since(lastStateSent) < stateRefreshInterval {
+			continue
+		}
 		nonce++
 
-		conn.Write(serialize(myState))
-	}
+		if _, err := conn.Write(serialize(*myState)); err == nil {
+			s.metrics.statesSent.Inc()
+		}
+		lastState = myState
+		lastStateSent = s.clock.Now()
 
+		if leaving {
+			for range leaveRepetitions {
+				if _, err := conn.Write(serializeLeave(leave{id: s.elevatorID, incarnation: s.incarnation})); err == nil {
+					s.metrics.leavesSent.Inc()
+				}
+			}
+			return
+		}
+	}
 }
 
-// Listens for incoming elevator states over UDP and updates local states.
-func receiveStates() {
-	var conn *net.UDPConn
+// Listens for incoming elevator states and updates local states.
+func (s *Sync) receiveStates(ctx context.Context) {
+	var conn io.ReadCloser
 
 	for {
 		var err error
-		addr, _ := net.ResolveUDPAddr("udp", broadcastAddr+":"+broadcastPort)
-		conn, err = net.ListenUDP("udp", addr)
+		conn, err = s.transport.Listen(BroadcastPort)
 
 		if err == nil {
 			break
 		}
-		time.Sleep(1 * time.Second)
+		if !clock.SleepContext(ctx, s.clock, 1*time.Second) {
+			return
+		}
 	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() }) // unblocks Read
+	defer stop()
 	defer conn.Close()
 
+	// States of other sizes cannot be merged with ours
+	numFloors := len(s.elevator.GetRequests())
+	mismatched := make(map[int]bool) // peers whose states were rejected for their number of floors
 	buf := make([]byte, 1024)
 	for {
 		n, err := conn.Read(buf)
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			continue
 		}
-		stateMsg := deserialize(buf[:n])
-		stateMsg.lastSync = time.Now()
+		if !wellFormed(buf[:n], numFloors) {
+			s.metrics.messagesMalformed.Inc()
+			if wellFormed(buf[:n], 0) && !mismatched[int(buf[1])] {
+				mismatched[int(buf[1])] = true
+				_log.Warn("ignoring states of elevator with other number of floors", "peer", buf[1],
+					"floors", len(deserialize(buf[:n]).request), "ours", numFloors)
+			}
+			continue
+		}
+		if messageType(buf[0]) == msgHeartbeat {
+			s.metrics.heartbeatsReceived.Inc()
+			s.publishMemberEvents(ctx, s.updateHeartbeat(deserializeHeartbeat(buf[:n]), s.clock.Now()))
+			continue
+		}
+		if messageType(buf[0]) == msgLeave {
+			s.metrics.leavesReceived.Inc()
+			l := deserializeLeave(buf[:n])
+			events, changes, orders := s.updateLeave(l, s.clock.Now())
+			s.publishMemberEvents(ctx, events)
+			s.publishChanges(changes)
+			if orders != nil {
+				_log.Info("elevator left, reassigning orders", "peer", l.id)
+				s.reassignOrders(ctx, orders)
+			}
+			continue
+		}
 
-		updateStates(stateMsg)
+		s.metrics.statesReceived.Inc()
+		stateMsg := deserialize(buf[:n])
+		stateMsg.lastSync = s.clock.Now()
+
+		// Read before locking, as statesync never holds its lock while reading the local elevator
+		ours := s.elevator.GetRequests()
+		events, changes, orphaned, duplicates := s.updateStates(stateMsg, ours)
+		s.publishMemberEvents(ctx, events)
+		s.publishChanges(changes)
+		if orphaned != nil {
+			_log.Info("elevator restarted, reassigning orders of its previous incarnation", "peer", stateMsg.id)
+			s.reassignOrders(ctx, orphaned)
+		}
+		for _, duplicate := range duplicates {
+			_log.Info("elevator rejoined and keeps hall call", "peer", stateMsg.id, "call", duplicate)
+			select {
+			case s.unassignChan <- duplicate:
+			case <-ctx.Done():
+				return
+			}
+		}
 	}
 }
 
 // Monitors elevator states and reassigns orders if an elevator is out of sync.
-func monitorFailedSyncs(reassignmentChan chan elevio.ButtonEvent) {
-	ticker := time.NewTicker(syncTimeout)
+func (s *Sync) monitorFailedSyncs(ctx context.Context) {
+	ticker := s.clock.NewTicker(monitorInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		for id, s := range _states {
-			if s == nil {
-				continue
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		s.mtx.Lock()
+		events, left, handover := s.members.check(s.clock.Now())
+		s.metrics.peerFailures.Add(float64(len(left)))
+		if s.connectivity.update(s.clock.Now()) {
+			if s.connectivity.offline {
+				_log.Warn("lost the network, serving all hall calls on our own")
+				isolatedEvents, isolatedLeft := s.members.leaveAll()
+				events = append(events, isolatedEvents...)
+				left = append(left, isolatedLeft...)
+			} else {
+				_log.Info("network is back, rejoining the other elevators")
+			}
+		}
+		failedOrders := make([][][3]bool, 0, len(left)+len(handover))
+		var changes []Change
+		for _, id := range left {
+			if id < len(s.states) && s.states[id] != nil {
+				_log.Warn("elevator failed, reassigning orders", "peer", id, "phi", s.members.members[id].Phi)
+				failedOrders = append(failedOrders, s.states[id].GetRequests())
+				s.states[id] = nil
+				changes = append(changes, Change{Kind: CK_PeerFailed, ElevatorID: id})
 			}
-			if time.Since(s.lastSync) > syncTimeout && id != _elevatorID {
-				log.Printf("Elevator %d has not synced for over %v. Reassigning orders.", id, syncTimeout)
+		}
+		for _, id := range handover {
+			if id < len(s.states) && s.states[id] != nil {
+				_log.Info("elevator unavailable, reassigning orders", "peer", id, "availability", s.members.availability(id))
+				failedOrders = append(failedOrders, s.states[id].GetRequests())
+			}
+		}
+		s.mtx.Unlock()
 
-				_mtx.Lock()
-				_states[id] = nil
-				_mtx.Unlock()
+		s.publishMemberEvents(ctx, events)
+		s.publishChanges(changes)
+		for _, orders := range failedOrders {
+			s.reassignOrders(ctx, orders)
+		}
+	}
+}
 
-				reassignOrders(s.request, reassignmentChan)
-			}
+// Forwards membership `events` to the member channel until `ctx` is done. Must not be called
+// while holding `mtx`.
+func (s *Sync) publishMemberEvents(ctx context.Context, events []MemberEvent) {
+	for _, event := range events {
+		select {
+		case s.memberChan <- event:
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
 // reassignOrders detects an elevators (`id`) which failed to sync and reasigns it's orders.
-func reassignOrders(orders [][3]bool, reassignmentChan chan elevio.ButtonEvent) {
+func (s *Sync) reassignOrders(ctx context.Context, orders [][3]bool) {
 	btns := [...]elevio.ButtonType{elevio.BT_HallDown, elevio.BT_HallUp}
 	for floor, order := range orders {
 		for _, btn := range btns {
 			if order[btn] {
-				reassignmentChan <- elevio.ButtonEvent{
-					Floor:  floor,
-					Button: elevio.ButtonType(btn),
+				s.metrics.reassignedOrders.Inc()
+				select {
+				case s.reassignmentChan <- elevio.ButtonEvent{Floor: floor, Button: elevio.ButtonType(btn)}:
+				case <-ctx.Done():
+					return
 				}
 				orders[floor][btn] = false
 			}
@@ -218,54 +456,90 @@ func reassignOrders(orders [][3]bool, reassignmentChan chan elevio.ButtonEvent)
 	}
 }
 
-// Updates the stored state of an elevator `s`.
-func updateStates(s *elevatorState) {
-	_mtx.Lock()
-	defer _mtx.Unlock()
+// Records the liveness and availability of the elevator sending heartbeat `h` at `now`.
+// Returns the resulting membership events.
+func (s *Sync) updateHeartbeat(h heartbeat, now time.Time) []MemberEvent {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	accepted, events := s.members.observe(h.id, h.incarnation, now)
+	if !accepted {
+		s.metrics.messagesDropped.Inc()
+	} else {
+		if h.id != s.elevatorID {
+			s.connectivity.heard(now)
+		}
+		s.members.heartbeat(h.id, now)
+		s.members.setAvailability(h.id, h.availability, now)
+	}
+	return events
+}
+
+// Records that the elevator sending leave message `l` at `now` left for good and drops its state.
+// Returns the resulting membership events and changes, and its requests unless its hall calls
+// were handed over already.
+func (s *Sync) updateLeave(l leave, now time.Time) ([]MemberEvent, []Change, [][3]bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 
-	id := s.id
-	if id >= len(_states) {
-		_states = append(_states, make([]*elevatorState, (id+1)-len(_states))...)
+	if l.id == s.elevatorID {
+		return nil, nil, nil
 	}
+	accepted, events, handedOver := s.members.depart(l.id, l.incarnation, now)
+	if !accepted {
+		s.metrics.messagesDropped.Inc()
+		return nil, nil, nil
+	}
+	s.metrics.peerDepartures.Inc()
 
-	vOld := _states[id]
-	if vOld == nil || vOld.nonce < s.nonce {
-		_states[id] = s
+	if l.id >= len(s.states) || s.states[l.id] == nil {
+		return events, nil, nil
+	}
+	var orders [][3]bool
+	if !handedOver {
+		orders = s.states[l.id].GetRequests()
 	}
+	s.states[l.id] = nil
+	return events, []Change{{Kind: CK_PeerLeft, ElevatorID: l.id}}, orders
 }
 
-// Detects if an elevator is stuck and sets its online flag accordingly.
-func ElevatorStuck(elevator types.ElevatorState, errorChan chan string) {
-	timeSinceLastAction(elevator)
-	hasActiveCalls := false
-	requests := elevator.GetRequests()
-	for _, floorRequests := range requests {
-		for _, active := range floorRequests {
-			if active {
-				hasActiveCalls = true
-				break
-			}
-		}
-		if hasActiveCalls {
-			break
-		}
+// Updates the stored state of an elevator `state`, given our requests `ours`. Returns the
+// resulting membership events and changes, the requests of its previous incarnation if the
+// elevator restarted and the hall calls we must give up because the elevator rejoined after a
+// partition and also holds them.
+func (s *Sync) updateStates(state *elevatorState, ours [][3]bool) ([]MemberEvent, []Change, [][3]bool, []elevio.ButtonEvent) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	id := state.id
+	if id >= len(s.states) {
+		s.states = append(s.states, make([]*elevatorState, (id+1)-len(s.states))...)
 	}
-	if (hasActiveCalls) && (time.Since(lastActionTime) > 5*time.Second && !(elevator.GetDirection() == elevio.MD_Stop)) {
-		log.Printf("Elevator stuck with active calls and last action time %v", time.Since(lastActionTime))
-		errorChan <- "Elevator stuck"
+
+	accepted, events := s.members.observe(id, state.incarnation, state.lastSync)
+	if !accepted {
+		s.metrics.messagesDropped.Inc()
+		return nil, nil, nil, nil
+	}
+
+	var orphaned [][3]bool
+	vOld := s.states[id]
+	if vOld != nil && vOld.incarnation < state.incarnation && id != s.elevatorID {
+		orphaned = vOld.GetRequests()
+	}
+	var changes []Change
+	if vOld == nil || vOld.incarnation < state.incarnation || vOld.nonce < state.nonce {
+		changes = diffStates(vOld, state)
+		s.states[id] = state
+		s.members.stateAccepted(id)
+		s.members.setAvailability(id, state.availability, state.lastSync)
+	} else {
+		s.metrics.messagesDropped.Inc()
 	}
-}
 
-// Move to a better place later
-var lastActionTime time.Time
-var prevFloor int
-var prevDirection elevio.MotorDirection
-
-// Updates the lastActionTime of an elevator if it changes direction or floor.
-func timeSinceLastAction(elevator types.ElevatorState) {
-	if elevator.GetFloor() != prevFloor || elevator.GetDirection() != prevDirection {
-		lastActionTime = time.Now()
-		prevFloor = elevator.GetFloor()
-		prevDirection = elevator.GetDirection()
+	var duplicates []elevio.ButtonEvent
+	if id != s.elevatorID && s.members.takeHealed(id) {
+		duplicates = duplicateHallCalls(s.elevatorID, ours, id, state.request)
 	}
+	return events, changes, orphaned, duplicates
 }
@@ -0,0 +1,389 @@
+package statesync
+
+import (
+	"context"
+	"elevator/clock"
+	"elevator/elevio"
+	"elevator/transport"
+	"elevator/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fixedElevator is an elevator which never moves on its own.
+type fixedElevator struct {
+	id        int
+	floor     int
+	direction elevio.MotorDirection
+	requests  [][3]bool
+	available types.Availability
+}
+
+func (e *fixedElevator) GetID() int                          { return e.id }
+func (e *fixedElevator) GetFloor() int                       { return e.floor }
+func (e *fixedElevator) GetDirection() elevio.MotorDirection { return e.direction }
+func (e *fixedElevator) GetRequests() [][3]bool              { return e.requests }
+func (e *fixedElevator) GetAvailability() types.Availability { return e.available }
+func (e *fixedElevator) GetBehaviour() types.Behaviour       { return types.BH_Idle }
+func (e *fixedElevator) IsDoorOpen() bool                    { return false }
+func (e *fixedElevator) IsObstructed() bool                  { return false }
+func (e *fixedElevator) IsBetweenFloors() bool               { return false }
+func (e *fixedElevator) GetCapacity() int                    { return 0 }
+
+// Advances `clk` by `d` in heartbeat intervals, giving all goroutines time to react to each.
+func advance(clk *clock.Fake, d time.Duration) {
+	for end := clk.Now().Add(d); clk.Now().Before(end); {
+		clk.Advance(min(heartbeatInterval, end.Sub(clk.Now())))
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Returns the first event of `events` about elevator `id`, or false if there is none.
+func nextEventOf(events chan MemberEvent, id int) (MemberEvent, bool) {
+	for {
+		select {
+		case event := <-events:
+			if event.ElevatorID == id {
+				return event, true
+			}
+		default:
+			return MemberEvent{}, false
+		}
+	}
+}
+
+func TestSync_DetectsFailedElevator(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	memberEvents := make(chan MemberEvent, 64)
+	for id := range 2 {
+		elevator := &fixedElevator{id: id, requests: make([][3]bool, 4)}
+		events := memberEvents
+		if id == 1 {
+			events = make(chan MemberEvent, 64)
+		}
+		s := New(elevator, network.Node(id), clk, make(chan elevio.ButtonEvent, 8), nil, events)
+		s.Start(context.Background())
+	}
+
+	advance(clk, time.Second)
+	if event, ok := nextEventOf(memberEvents, 1); !ok || event.Type != ME_Join {
+		t.Fatalf("Expected elevator 1 to join, was %+v", event)
+	}
+
+	network.Disconnect(1)
+	advance(clk, 200*time.Millisecond)
+	if event, ok := nextEventOf(memberEvents, 1); ok {
+		t.Fatalf("Expected no event within the acceptable heartbeat pause, was %+v", event)
+	}
+	advance(clk, 2*time.Second)
+	if event, ok := nextEventOf(memberEvents, 1); !ok || event.Type != ME_Suspect {
+		t.Fatalf("Expected elevator 1 to be suspected, was %+v", event)
+	}
+	if event, ok := nextEventOf(memberEvents, 1); !ok || event.Type != ME_Leave {
+		t.Fatalf("Expected elevator 1 to leave, was %+v", event)
+	}
+}
+
+func TestSync_TakesOverHallCallsOfUnavailableElevator(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	requests := make([][3]bool, 4)
+	requests[2][elevio.BT_HallUp] = true
+	requests[3][elevio.BT_Cab] = true
+	reassignments := make(chan elevio.ButtonEvent, 8)
+	var syncs []*Sync
+	for id, elevator := range []*fixedElevator{
+		{id: 0, requests: make([][3]bool, 4)},
+		{id: 1, requests: requests, available: types.AV_OutOfService},
+	} {
+		s := New(elevator, network.Node(id), clk, reassignments, nil, make(chan MemberEvent, 64))
+		s.Start(context.Background())
+		syncs = append(syncs, s)
+	}
+
+	advance(clk, time.Second)
+	if alive := syncs[0].GetAliveElevatorIDs(); len(alive) != 2 {
+		t.Errorf("Expected the unavailable elevator to stay alive, was %v", alive)
+	}
+	if state := syncs[0].GetState(1); state == nil || state.GetAvailability() != types.AV_OutOfService {
+		t.Errorf("Expected the state of elevator 1 to be out of service, was %v", state)
+	}
+	select {
+	case call := <-reassignments:
+		if call != (elevio.ButtonEvent{Floor: 2, Button: elevio.BT_HallUp}) {
+			t.Errorf("Expected the hall call of elevator 1 to be taken over, was %+v", call)
+		}
+	default:
+		t.Error("Expected the hall call of elevator 1 to be taken over")
+	}
+}
+
+func TestSync_TakesOverHallCallsOfDepartedElevator(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	requests := make([][3]bool, 4)
+	requests[2][elevio.BT_HallUp] = true
+	requests[3][elevio.BT_Cab] = true
+	reassignments := make(chan elevio.ButtonEvent, 8)
+	memberEvents := make(chan MemberEvent, 64)
+	s := New(&fixedElevator{id: 0, requests: make([][3]bool, 4)}, network.Node(0), clk, reassignments, nil, memberEvents)
+	s.Start(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	departing := New(&fixedElevator{id: 1, requests: requests}, network.Node(1), clk,
+		make(chan elevio.ButtonEvent, 8), nil, make(chan MemberEvent, 64))
+	departing.Start(ctx)
+
+	advance(clk, time.Second)
+	if event, ok := nextEventOf(memberEvents, 1); !ok || event.Type != ME_Join {
+		t.Fatalf("Expected elevator 1 to join, was %+v", event)
+	}
+
+	cancel()
+	departing.Wait()
+	advance(clk, monitorInterval)
+	if event, ok := nextEventOf(memberEvents, 1); !ok || event.Type != ME_Depart {
+		t.Errorf("Expected elevator 1 to depart, was %+v", event)
+	}
+	select {
+	case call := <-reassignments:
+		if call != (elevio.ButtonEvent{Floor: 2, Button: elevio.BT_HallUp}) {
+			t.Errorf("Expected the hall call of elevator 1 to be taken over, was %+v", call)
+		}
+	default:
+		t.Error("Expected the hall call of elevator 1 to be taken over at once")
+	}
+
+	advance(clk, 5*time.Second)
+	if event, ok := nextEventOf(memberEvents, 1); ok {
+		t.Errorf("Expected the failure detector to skip the departed elevator, was %+v", event)
+	}
+	if len(reassignments) != 0 {
+		t.Errorf("Expected the hall call to be taken over once, was %d more times", len(reassignments))
+	}
+	if alive := s.GetAliveElevatorIDs(); len(alive) != 1 {
+		t.Errorf("Expected only elevator 0 to be alive, was %v", alive)
+	}
+}
+
+func TestSync_RejoinsElevatorRestartedWithinOneSecond(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	memberEvents := make(chan MemberEvent, 64)
+	s := New(&fixedElevator{id: 0, requests: make([][3]bool, 4)}, network.Node(0), clk, make(chan elevio.ButtonEvent, 8), nil, memberEvents)
+	s.Start(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	first := New(&fixedElevator{id: 1, requests: make([][3]bool, 4)}, network.Node(1), clk,
+		make(chan elevio.ButtonEvent, 8), nil, make(chan MemberEvent, 64))
+	first.Start(ctx)
+
+	advance(clk, 100*time.Millisecond)
+	if event, ok := nextEventOf(memberEvents, 1); !ok || event.Type != ME_Join {
+		t.Fatalf("Expected elevator 1 to join, was %+v", event)
+	}
+	cancel()
+	first.Wait()
+	advance(clk, monitorInterval)
+	if event, ok := nextEventOf(memberEvents, 1); !ok || event.Type != ME_Depart {
+		t.Fatalf("Expected elevator 1 to depart, was %+v", event)
+	}
+
+	restarted := New(&fixedElevator{id: 1, requests: make([][3]bool, 4)}, network.Node(1), clk,
+		make(chan elevio.ButtonEvent, 8), nil, make(chan MemberEvent, 64))
+	restarted.Start(context.Background())
+	advance(clk, 100*time.Millisecond)
+	if event, ok := nextEventOf(memberEvents, 1); !ok || event.Type != ME_Rejoin || event.Incarnation <= first.incarnation {
+		t.Errorf("Expected elevator 1 to rejoin with a greater incarnation than %d, was %+v", first.incarnation, event)
+	}
+	if alive := s.GetAliveElevatorIDs(); len(alive) != 2 {
+		t.Errorf("Expected elevator 1 to be alive again, was %v", alive)
+	}
+}
+
+func TestSync_RejectsStatesOfOtherFloorCount(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	var syncs []*Sync
+	for id, floors := range []int{4, 2} {
+		elevator := &fixedElevator{id: id, requests: make([][3]bool, floors)}
+		s := New(elevator, network.Node(id), clk, make(chan elevio.ButtonEvent, 8), nil, make(chan MemberEvent, 64))
+		s.Start(context.Background())
+		syncs = append(syncs, s)
+	}
+
+	malformed := syncs[0].metrics.messagesMalformed.Value()
+	advance(clk, time.Second)
+	if state := syncs[0].GetState(1); state != nil {
+		t.Errorf("Expected the state of the elevator with 2 floors to be rejected, was %v", state)
+	}
+	if syncs[0].metrics.messagesMalformed.Value() == malformed {
+		t.Error("Expected the rejected states to be counted as malformed")
+	}
+	if a := syncs[0].GetAvailability(1); a != types.AV_OutOfService {
+		t.Errorf("Expected the elevator with 2 floors to be out of service, was %v", a)
+	}
+}
+
+func TestSync_AppliesLegacyStates(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	s := New(&fixedElevator{id: 0, requests: make([][3]bool, 2)}, network.Node(0), clk,
+		make(chan elevio.ButtonEvent, 8), nil, make(chan MemberEvent, 64))
+	s.Start(context.Background())
+	conn, err := network.Node(3).Dial(BroadcastPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	legacy := []byte{byte(msgState), 3, 0x39, 0x30, 0, 0, 99, 0, 0, 0, 1, 0xff, 1, 0, 0, 0, 0, 0}
+	for range 10 {
+		conn.Write(legacy)
+		advance(clk, heartbeatInterval)
+		if s.GetState(3) != nil {
+			break
+		}
+	}
+	state := s.GetState(3)
+	if state == nil || state.GetFloor() != 1 || !state.GetRequests()[0][elevio.BT_HallUp] {
+		t.Errorf("Expected the legacy state of elevator 3 to be applied, was %v", state)
+	}
+}
+
+// Returns the changes of `changes` about elevator `id` delivered so far.
+func changesOf(changes <-chan Change, id int) []Change {
+	var of []Change
+	for {
+		select {
+		case change := <-changes:
+			if change.ElevatorID == id {
+				of = append(of, change)
+			}
+		default:
+			return of
+		}
+	}
+}
+
+func TestSync_PublishesChanges(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	requests := make([][3]bool, 4)
+	requests[2][elevio.BT_HallUp] = true
+	var changes <-chan Change
+	for id, elevator := range []*fixedElevator{{id: 0, requests: make([][3]bool, 4)}, {id: 1, floor: 3, requests: requests}} {
+		s := New(elevator, network.Node(id), clk, make(chan elevio.ButtonEvent, 8), nil, make(chan MemberEvent, 64))
+		if id == 0 {
+			changes = s.Subscribe()
+		}
+		s.Start(context.Background())
+	}
+
+	advance(clk, time.Second)
+	received := changesOf(changes, 1)
+	if len(received) != 2 || received[0].Kind != CK_StateUpdated || received[0].State.GetFloor() != 3 ||
+		received[1].Kind != CK_RequestAdded || received[1].Request != (elevio.ButtonEvent{Floor: 2, Button: elevio.BT_HallUp}) {
+		t.Fatalf("Expected the state and hall call of elevator 1 once, was %+v", received)
+	}
+
+	network.Disconnect(1)
+	advance(clk, 5*time.Second)
+	if received := changesOf(changes, 1); len(received) != 1 || received[0].Kind != CK_PeerFailed {
+		t.Errorf("Expected elevator 1 to fail, was %+v", received)
+	}
+}
+
+// Meant to be run with -race: reads everything statesync hands out while states arrive, a peer
+// fails and its hall calls are reassigned.
+func TestSync_ReadsAreSafeWhileStatesChange(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	requests := make([][3]bool, 4)
+	requests[1][elevio.BT_HallDown] = true
+	var syncs []*Sync
+	for id := range 3 {
+		elevator := &fixedElevator{id: id, floor: id, requests: requests}
+		s := New(elevator, network.Node(id), clk, make(chan elevio.ButtonEvent, 64), nil, make(chan MemberEvent, 64))
+		s.Start(context.Background())
+		syncs = append(syncs, s)
+	}
+	changes := syncs[0].Subscribe()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	read := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					f()
+				}
+			}
+		}()
+	}
+	read(func() {
+		view := syncs[0].Snapshot()
+		for _, id := range view.Alive() {
+			if state := view.State(id); state != nil {
+				state.GetRequests()
+			}
+			view.Availability(id)
+		}
+	})
+	read(func() {
+		if state := syncs[0].GetState(2); state != nil {
+			state.GetRequests()[1][elevio.BT_HallDown] = false
+		}
+		syncs[0].GetOrAggregatedLiveRequests(requests)
+		syncs[0].GetMembers()
+	})
+	read(func() {
+		select {
+		case change := <-changes:
+			if change.State != nil {
+				change.State.GetRequests()
+			}
+		default:
+		}
+	})
+
+	advance(clk, time.Second)
+	network.Disconnect(2)
+	advance(clk, 5*time.Second)
+	close(done)
+	wg.Wait()
+
+	if alive := syncs[0].Snapshot().Alive(); len(alive) != 2 {
+		t.Errorf("Expected elevator 2 to have failed, was %v", alive)
+	}
+}
+
+func TestSync_StopsWhenContextDone(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	network := transport.NewNetwork(transport.NetworkConfig{Clock: clk})
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(&fixedElevator{id: 0, requests: make([][3]bool, 4)}, network.Node(0), clk,
+		make(chan elevio.ButtonEvent), nil, make(chan MemberEvent))
+	changes := s.Subscribe()
+	s.Start(ctx)
+	advance(clk, time.Second)
+
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the state sync to stop without the clock advancing")
+	}
+	for range changes { // ends once the subscription was closed
+	}
+}
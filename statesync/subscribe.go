@@ -0,0 +1,220 @@
+package statesync
+
+import (
+	"elevator/elevio"
+	"elevator/metrics"
+	"elevator/types"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Changes buffered per subscriber. Changes beyond are coalesced until the subscriber caught up.
+const subscriptionBuffer = 64
+
+// ChangeKind is the kind of a change of the state of an elevator.
+type ChangeKind int
+
+const (
+	CK_StateUpdated   ChangeKind = 0 // the elevator sent a state which differs from the last one
+	CK_RequestAdded   ChangeKind = 1 // the elevator holds a request it did not hold before
+	CK_RequestCleared ChangeKind = 2 // the elevator no longer holds a request
+	CK_PeerFailed     ChangeKind = 3 // the elevator failed and its state was dropped
+	CK_PeerLeft       ChangeKind = 4 // the elevator announced leaving and its state was dropped
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case CK_StateUpdated:
+		return "state_updated"
+	case CK_RequestAdded:
+		return "request_added"
+	case CK_RequestCleared:
+		return "request_cleared"
+	case CK_PeerFailed:
+		return "peer_failed"
+	case CK_PeerLeft:
+		return "peer_left"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change of the state of elevator `ElevatorID`. `State` is its new state if the state was
+// updated, `Request` the request added or cleared.
+type Change struct {
+	Kind       ChangeKind
+	ElevatorID int
+	State      types.ElevatorState
+	Request    elevio.ButtonEvent
+}
+
+// Subscribe returns a channel on which every change of the state of an elevator is delivered,
+// including changes of our own state once we received it back. A state update is followed by
+// the requests it added and cleared. Statesync never waits for subscribers: once one lags behind
+// by more than `subscriptionBuffer` changes, it only gets the latest state and request changes
+// of each elevator, and nothing from before an elevator failed or left. The channel is closed
+// once the state sync stopped.
+func (s *Sync) Subscribe() <-chan Change {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sub := &subscription{
+		ready:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		out:       make(chan Change, subscriptionBuffer),
+		coalesced: s.metrics.changesCoalesced,
+	}
+	s.subscribers = append(s.subscribers, sub)
+	go sub.deliver()
+	return sub.out
+}
+
+// subscription delivers changes to one subscriber, buffering those not fitting into `out`.
+type subscription struct {
+	mtx       sync.Mutex
+	overflow  []Change      // in order, coalesced
+	sending   bool          // whether `deliver` is sending `overflow[0]`
+	ready     chan struct{} // signalled whenever changes overflowed, unless a signal is pending anyway
+	done      chan struct{} // closed once the state sync stopped
+	out       chan Change
+	coalesced *metrics.Counter // counts changes superseded before they were delivered
+}
+
+// Queues `changes` for delivery. Never blocks.
+func (sub *subscription) push(changes []Change) {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+
+	for _, change := range changes {
+		if len(sub.overflow) == 0 {
+			select {
+			case sub.out <- change:
+				continue
+			default:
+			}
+		}
+		sub.overflow = append(sub.overflow, change)
+	}
+	if len(sub.overflow) == 0 {
+		return
+	}
+
+	first := 0
+	if sub.sending {
+		first = 1
+	}
+	coalesced := coalesce(sub.overflow[first:])
+	sub.coalesced.Add(float64(len(sub.overflow) - first - len(coalesced)))
+	sub.overflow = append(sub.overflow[:first:first], coalesced...)
+
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Moves the changes which overflowed to `out` in order until the state sync stopped, then
+// closes `out`.
+func (sub *subscription) deliver() {
+	defer close(sub.out)
+	for {
+		sub.mtx.Lock()
+		if len(sub.overflow) == 0 {
+			sub.mtx.Unlock()
+			select {
+			case <-sub.ready:
+				continue
+			case <-sub.done:
+				return
+			}
+		}
+		change := sub.overflow[0]
+		sub.sending = true
+		sub.mtx.Unlock()
+
+		select {
+		case sub.out <- change:
+		case <-sub.done:
+			return
+		}
+
+		sub.mtx.Lock()
+		sub.overflow = sub.overflow[1:]
+		sub.sending = false
+		sub.mtx.Unlock()
+	}
+}
+
+// Delivers `changes` to all subscribers. Must not be called while holding `mtx`.
+func (s *Sync) publishChanges(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	s.mtx.RLock()
+	subscribers := slices.Clone(s.subscribers)
+	s.mtx.RUnlock()
+
+	for _, sub := range subscribers {
+		sub.push(changes)
+	}
+}
+
+// Returns `changes` without the changes superseded by later ones: state updates by later state
+// updates of the same elevator, request changes by later changes of the same request, and all
+// changes of an elevator by its failing or leaving later on. The order is kept.
+func coalesce(changes []Change) []Change {
+	type key struct {
+		id      int
+		kind    ChangeKind
+		request elevio.ButtonEvent
+	}
+	seen := make(map[key]bool)
+	gone := make(map[int]bool) // elevators failing or leaving later on
+	kept := make([]Change, 0, len(changes))
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		k := key{id: c.ElevatorID, kind: c.Kind}
+		switch c.Kind {
+		case CK_RequestAdded, CK_RequestCleared:
+			k = key{id: c.ElevatorID, kind: CK_RequestAdded, request: c.Request}
+		case CK_PeerFailed, CK_PeerLeft:
+			k.kind = CK_PeerFailed
+		}
+		if seen[k] || (gone[c.ElevatorID] && k.kind != CK_PeerFailed) {
+			continue
+		}
+		seen[k] = true
+		if k.kind == CK_PeerFailed {
+			gone[c.ElevatorID] = true
+		}
+		kept = append(kept, c)
+	}
+	slices.Reverse(kept)
+	return kept
+}
+
+// Returns the changes from state `old`, nil if unknown, to state `new`.
+func diffStates(old *elevatorState, new *elevatorState) []Change {
+	if new.sameAs(old) {
+		return nil
+	}
+	changes := []Change{{Kind: CK_StateUpdated, ElevatorID: new.id, State: new}}
+	for floor, requests := range new.request {
+		for btn, held := range requests {
+			wasHeld := old != nil && floor < len(old.request) && old.request[floor][btn]
+			if held == wasHeld {
+				continue
+			}
+			kind := CK_RequestAdded
+			if !held {
+				kind = CK_RequestCleared
+			}
+			changes = append(changes, Change{
+				Kind:       kind,
+				ElevatorID: new.id,
+				Request:    elevio.ButtonEvent{Floor: floor, Button: elevio.ButtonType(btn)},
+			})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,62 @@
+package statesync
+
+import (
+	"elevator/clock"
+	"elevator/elevio"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubscribe_CoalescesChangesOfLaggingSubscriber(t *testing.T) {
+	s := New(&fixedElevator{requests: make([][3]bool, 4)}, nil, clock.Real{}, nil, nil, nil)
+	changes := s.Subscribe()
+	defer close(s.subscribers[0].done)
+
+	call := elevio.ButtonEvent{Floor: 2, Button: elevio.BT_HallUp}
+	for floor := range 4 * subscriptionBuffer {
+		s.publishChanges([]Change{
+			{Kind: CK_StateUpdated, ElevatorID: 1, State: &elevatorState{id: 1, currFloor: floor}},
+			{Kind: CK_RequestAdded, ElevatorID: 1, Request: call},
+			{Kind: CK_RequestCleared, ElevatorID: 1, Request: call},
+		})
+	}
+	s.publishChanges([]Change{{Kind: CK_StateUpdated, ElevatorID: 2, State: &elevatorState{id: 2}}, {Kind: CK_PeerFailed, ElevatorID: 2}})
+
+	// The buffer, maybe the change on its way into the buffer and the latest changes
+	var received []Change
+	for len(received) < subscriptionBuffer+4 {
+		select {
+		case change := <-changes:
+			received = append(received, change)
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	want := []Change{
+		{Kind: CK_StateUpdated, ElevatorID: 1, State: &elevatorState{id: 1, currFloor: 4*subscriptionBuffer - 1}},
+		{Kind: CK_RequestCleared, ElevatorID: 1, Request: call},
+		{Kind: CK_PeerFailed, ElevatorID: 2},
+	}
+	if len(received) < subscriptionBuffer+3 || !reflect.DeepEqual(received[len(received)-3:], want) {
+		t.Errorf("Expected only the latest changes beyond the buffer, was %+v", received[min(len(received), subscriptionBuffer):])
+	}
+}
+
+func TestCoalesce_KeepsLatestChanges(t *testing.T) {
+	call := elevio.ButtonEvent{Floor: 1, Button: elevio.BT_HallDown}
+	changes := []Change{
+		{Kind: CK_StateUpdated, ElevatorID: 0},
+		{Kind: CK_RequestAdded, ElevatorID: 0, Request: call},
+		{Kind: CK_StateUpdated, ElevatorID: 1},
+		{Kind: CK_PeerLeft, ElevatorID: 1},
+		{Kind: CK_StateUpdated, ElevatorID: 1},
+		{Kind: CK_StateUpdated, ElevatorID: 0},
+		{Kind: CK_RequestCleared, ElevatorID: 0, Request: call},
+	}
+	want := []Change{changes[3], changes[4], changes[5], changes[6]}
+	if coalesced := coalesce(changes); !reflect.DeepEqual(coalesced, want) {
+		t.Errorf("Expected %+v, was %+v", want, coalesced)
+	}
+}
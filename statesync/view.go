@@ -0,0 +1,61 @@
+package statesync
+
+import (
+	"elevator/types"
+	"slices"
+)
+
+// View is a consistent view of all elevators at one instant. It is never modified after it was
+// taken, so it can be read without locking while statesync moves on.
+type View struct {
+	Self    int  // ID of this elevator
+	Offline bool // whether this elevator lost the network entirely
+	Members []Member
+
+	alive        []int
+	states       map[int]types.ElevatorState
+	availability map[int]types.Availability
+}
+
+// Snapshot takes a view of the membership and the last state of every alive elevator.
+func (s *Sync) Snapshot() View {
+	self := s.elevator.GetAvailability()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	v := View{
+		Self:         s.elevatorID,
+		Offline:      s.connectivity.offline,
+		Members:      s.members.snapshot(),
+		alive:        s.members.aliveIDs(),
+		states:       make(map[int]types.ElevatorState),
+		availability: make(map[int]types.Availability),
+	}
+	for _, id := range v.alive {
+		v.availability[id] = s.members.availability(id)
+		if id < len(s.states) && s.states[id] != nil {
+			v.states[id] = s.states[id]
+		}
+	}
+	v.availability[s.elevatorID] = self
+	return v
+}
+
+// Alive returns the IDs of all alive elevators in ascending order, always including this one.
+func (v View) Alive() []int {
+	return slices.Clone(v.alive)
+}
+
+// State returns the last state of alive elevator `id`, or nil if there is none.
+func (v View) State(id int) types.ElevatorState {
+	return v.states[id]
+}
+
+// Availability of elevator `id`. Elevators which are not alive are out of service.
+func (v View) Availability(id int) types.Availability {
+	if a, exists := v.availability[id]; exists {
+		return a
+	}
+	return types.AV_OutOfService
+}
@@ -0,0 +1,63 @@
+package statesync
+
+import (
+	"elevator/elevio"
+	"elevator/types"
+	"errors"
+)
+
+// Message is a heartbeat, state or leave message as sent on the network, for tools listening to
+// the cluster.
+type Message struct {
+	Heartbeat     bool // if set only ID, Incarnation, Nonce and Availability are valid
+	Leave         bool // if set only ID and Incarnation are valid
+	ID            int
+	Incarnation   uint32
+	Nonce         int
+	Availability  types.Availability
+	Floor         int
+	Direction     elevio.MotorDirection
+	Behaviour     types.Behaviour
+	DoorOpen      bool
+	Obstructed    bool
+	BetweenFloors bool
+	Capacity      int
+	Requests      [][3]bool
+}
+
+// DecodeMessage deserializes a heartbeat, state or leave message received on `BroadcastPort`, of
+// elevators with any number of floors.
+func DecodeMessage(m []byte) (Message, error) {
+	if !wellFormed(m, 0) {
+		return Message{}, errors.New("malformed state sync message")
+	}
+	if messageType(m[0]) == msgHeartbeat {
+		h := deserializeHeartbeat(m)
+		return Message{
+			Heartbeat:    true,
+			ID:           h.id,
+			Incarnation:  h.incarnation,
+			Nonce:        h.nonce,
+			Availability: h.availability,
+		}, nil
+	}
+	if messageType(m[0]) == msgLeave {
+		l := deserializeLeave(m)
+		return Message{Leave: true, ID: l.id, Incarnation: l.incarnation}, nil
+	}
+	s := deserialize(m)
+	return Message{
+		ID:            s.id,
+		Incarnation:   s.incarnation,
+		Nonce:         s.nonce,
+		Availability:  s.availability,
+		Floor:         s.currFloor,
+		Direction:     s.currDirection,
+		Behaviour:     s.behaviour,
+		DoorOpen:      s.doorOpen,
+		Obstructed:    s.obstructed,
+		BetweenFloors: s.betweenFloors,
+		Capacity:      s.capacity,
+		Requests:      s.request,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package statesync
+
+import (
+	"elevator/elevio"
+	"elevator/types"
+	"reflect"
+	"testing"
+)
+
+func TestWire_DecodeState(t *testing.T) {
+	s := elevatorState{
+		id:            3,
+		incarnation:   12345,
+		nonce:         99,
+		currFloor:     2,
+		currDirection: elevio.MD_Down,
+		availability:  types.AV_OutOfService,
+		behaviour:     types.BH_DoorOpen,
+		doorOpen:      true,
+		obstructed:    true,
+		capacity:      8,
+		request:       [][3]bool{{true, false, false}, {false, false, true}},
+	}
+
+	m, err := DecodeMessage(serialize(s))
+	expected := Message{ID: 3, Incarnation: 12345, Nonce: 99, Availability: types.AV_OutOfService, Floor: 2, Direction: elevio.MD_Down,
+		Behaviour: types.BH_DoorOpen, DoorOpen: true, Obstructed: true, Capacity: 8, Requests: s.request}
+	if err != nil || !reflect.DeepEqual(m, expected) {
+		t.Errorf("Decoded state not as expected.\nExpected: %+v\nWas: %+v, %v", expected, m, err)
+	}
+
+	extended := append(serialize(s), 42, 7)
+	if m, err := DecodeMessage(extended); err != nil || !reflect.DeepEqual(m, expected) {
+		t.Errorf("Expected extensions after the requests to be skipped, was %+v, %v", m, err)
+	}
+	if _, err := DecodeMessage(serialize(s)[:stateHeaderLength+4]); err == nil {
+		t.Errorf("Expected truncated state to be rejected")
+	}
+	if wellFormed(serialize(s), 4) {
+		t.Errorf("Expected a state with 2 floors to be rejected by an elevator with 4")
+	}
+}
+
+func TestWire_DecodeLegacyState(t *testing.T) {
+	m := []byte{byte(msgState), 3, 0x39, 0x30, 0, 0, 99, 0, 0, 0, 2, 0xff, 1, 0, 0, 0, 0, 1}
+
+	decoded, err := DecodeMessage(m)
+	expected := Message{ID: 3, Incarnation: 12345, Nonce: 99, Floor: 2, Direction: elevio.MD_Down,
+		Requests: [][3]bool{{true, false, false}, {false, false, true}}}
+	if err != nil || !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Decoded legacy state not as expected.\nExpected: %+v\nWas: %+v, %v", expected, decoded, err)
+	}
+	if wellFormed(m, 4) {
+		t.Errorf("Expected a legacy state with 2 floors to be rejected by an elevator with 4")
+	}
+
+	// An earlier version sent one more header byte without changing the message type
+	extended := append(m[:legacyStateHeaderLength:legacyStateHeaderLength], append([]byte{0}, m[legacyStateHeaderLength:]...)...)
+	if _, err := DecodeMessage(extended); err == nil {
+		t.Errorf("Expected a legacy state with a longer header to be rejected")
+	}
+}
+
+func TestWire_DecodeHeartbeat(t *testing.T) {
+	h := heartbeat{id: 1, incarnation: 7, nonce: 5, availability: types.AV_Degraded}
+
+	m, err := DecodeMessage(serializeHeartbeat(h))
+	expected := Message{Heartbeat: true, ID: 1, Incarnation: 7, Nonce: 5, Availability: types.AV_Degraded}
+	if err != nil || !reflect.DeepEqual(m, expected) {
+		t.Errorf("Decoded heartbeat not as expected.\nExpected: %+v\nWas: %+v, %v", expected, m, err)
+	}
+	if _, err := DecodeMessage(serializeHeartbeat(h)[:5]); err == nil {
+		t.Errorf("Expected truncated heartbeat to be rejected")
+	}
+}
+
+func TestWire_DecodeLeave(t *testing.T) {
+	m, err := DecodeMessage(serializeLeave(leave{id: 2, incarnation: 42}))
+	expected := Message{Leave: true, ID: 2, Incarnation: 42}
+	if err != nil || !reflect.DeepEqual(m, expected) {
+		t.Errorf("Decoded leave not as expected.\nExpected: %+v\nWas: %+v, %v", expected, m, err)
+	}
+	if _, err := DecodeMessage(serializeLeave(leave{id: 2, incarnation: 42})[:3]); err == nil {
+		t.Errorf("Expected truncated leave to be rejected")
+	}
+}
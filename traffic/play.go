@@ -0,0 +1,46 @@
+package traffic
+
+import (
+	"bytes"
+	"elevator/clock"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Play presses every call of `calls` with `press` at its time, measured by `clk` from now.
+// Stops at the first error.
+func Play(calls []Call, clk clock.Clock, press func(Call) error) error {
+	start := clk.Now()
+	for _, c := range calls {
+		clk.Sleep(c.At - clk.Since(start))
+		if err := press(c); err != nil {
+			return fmt.Errorf("%s: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// APIPresser returns a press function for `Play` which injects every call into the control API of
+// its elevator, where `addrs[i]` is the API address of elevator `i`. Destinations are not pressed
+// since a passenger can not be told to board a real car.
+func APIPresser(client *http.Client, addrs []string) func(Call) error {
+	return func(c Call) error {
+		if c.Elevator >= len(addrs) {
+			return fmt.Errorf("no API address of elevator %d", c.Elevator)
+		}
+		body, _ := json.Marshal(map[string]any{"floor": c.Floor, "button": ButtonName(c.Button)})
+		resp, err := client.Post("http://"+addrs[c.Elevator]+"/api/calls", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusAccepted {
+			msg, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,112 @@
+package traffic
+
+import (
+	"elevator/elevio"
+	"math/rand"
+	"time"
+)
+
+// Profile is a pattern of passenger trips through a building.
+type Profile struct {
+	Name        string
+	Description string
+	trip        func(rng *rand.Rand, numFloors int) (origin int, destination int)
+}
+
+// Config describes the traffic generated from a profile. All random decisions are drawn from a
+// generator seeded with `Seed`, so equal configs yield equal scenarios.
+type Config struct {
+	Floors    int
+	Elevators int
+	Duration  time.Duration // passengers arrive within this time
+	Rate      float64       // mean number of passengers arriving per minute
+	Seed      int64
+}
+
+// The lobby is the ground floor.
+const lobby = 0
+
+// UpPeak is the morning rush: almost everybody enters at the lobby and rides up.
+var UpPeak = Profile{
+	Name:        "up-peak",
+	Description: "morning rush, 85% ride up from the lobby, 10% between floors, 5% down to the lobby",
+	trip: func(rng *rand.Rand, numFloors int) (int, int) {
+		switch p := rng.Float64(); {
+		case p < 0.85:
+			return lobby, upperFloor(rng, numFloors)
+		case p < 0.95:
+			return interFloor(rng, numFloors)
+		default:
+			return upperFloor(rng, numFloors), lobby
+		}
+	},
+}
+
+// Lunch is the midday traffic: people leave for lunch and come back at the same time.
+var Lunch = Profile{
+	Name:        "lunch",
+	Description: "midday, 40% ride down to the lobby, 40% up from the lobby, 20% between floors",
+	trip: func(rng *rand.Rand, numFloors int) (int, int) {
+		switch p := rng.Float64(); {
+		case p < 0.4:
+			return upperFloor(rng, numFloors), lobby
+		case p < 0.8:
+			return lobby, upperFloor(rng, numFloors)
+		default:
+			return interFloor(rng, numFloors)
+		}
+	},
+}
+
+// Random is uniform traffic between all floors.
+var Random = Profile{
+	Name:        "random",
+	Description: "uniform trips between any two floors",
+	trip:        interFloor,
+}
+
+// Profiles are all built-in profiles.
+var Profiles = []Profile{UpPeak, Lunch, Random}
+
+// ProfileByName returns the built-in profile called `name`.
+func ProfileByName(name string) (Profile, bool) {
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Generate draws passengers arriving at random with the rate of `cfg`. Each passenger presses the
+// hall button towards its destination at the panel of a random elevator.
+func (p Profile) Generate(cfg Config) []Call {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	meanInterval := float64(time.Minute) / cfg.Rate
+
+	var calls []Call
+	for at := time.Duration(rng.ExpFloat64() * meanInterval); at < cfg.Duration; at += time.Duration(rng.ExpFloat64() * meanInterval) {
+		origin, destination := p.trip(rng, cfg.Floors)
+		button := elevio.BT_HallUp
+		if destination < origin {
+			button = elevio.BT_HallDown
+		}
+		calls = append(calls, Call{At: at.Round(time.Millisecond), Floor: origin, Button: button, Elevator: rng.Intn(cfg.Elevators), Destination: &destination})
+	}
+	return calls
+}
+
+// Returns a floor above the lobby.
+func upperFloor(rng *rand.Rand, numFloors int) int {
+	return 1 + rng.Intn(numFloors-1)
+}
+
+// Returns two distinct floors.
+func interFloor(rng *rand.Rand, numFloors int) (int, int) {
+	origin := rng.Intn(numFloors)
+	destination := rng.Intn(numFloors - 1)
+	if destination >= origin {
+		destination++
+	}
+	return origin, destination
+}
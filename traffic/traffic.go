@@ -0,0 +1,124 @@
+// Package traffic describes passenger traffic as scenarios of timed calls, generates it from
+// built-in profiles and reads and writes it as JSONL scenario files.
+package traffic
+
+import (
+	"bufio"
+	"elevator/elevio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Call is a passenger pressing `Button` at `Floor` on the panels of elevator `Elevator`, `At` after
+// the start of the scenario. Hall calls may be pressed at any elevator. A passenger with a
+// `Destination` presses its cab button once a car opened its door at `Floor`.
+type Call struct {
+	At          time.Duration
+	Floor       int
+	Button      elevio.ButtonType
+	Elevator    int
+	Destination *int
+}
+
+// callLine is a line of a scenario file, e.g.
+// `{"at": "1m30s", "floor": 0, "button": "hall_up", "destination": 3}`.
+type callLine struct {
+	At          string `json:"at"`
+	Floor       int    `json:"floor"`
+	Button      string `json:"button"`
+	Elevator    int    `json:"elevator,omitempty"`
+	Destination *int   `json:"destination,omitempty"`
+}
+
+// Button names of scenario files, equal to the ones of the control API.
+var buttonNames = map[string]elevio.ButtonType{
+	"hall_up":   elevio.BT_HallUp,
+	"hall_down": elevio.BT_HallDown,
+	"cab":       elevio.BT_Cab,
+}
+
+// ButtonName returns the name of `b` in scenario files and the control API.
+func ButtonName(b elevio.ButtonType) string {
+	for name, button := range buttonNames {
+		if button == b {
+			return name
+		}
+	}
+	return fmt.Sprintf("ButtonType(%d)", int(b))
+}
+
+// Read parses a JSONL scenario file. Blank lines and lines starting with `#` are skipped.
+// The calls are returned ordered by time.
+func Read(r io.Reader) ([]Call, error) {
+	var calls []Call
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var l callLine
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		at, err := time.ParseDuration(l.At)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		button, exists := buttonNames[l.Button]
+		if !exists {
+			return nil, fmt.Errorf("line %d: unknown button %q", lineNum, l.Button)
+		}
+		if at < 0 || l.Floor < 0 || l.Elevator < 0 || (l.Destination != nil && *l.Destination < 0) {
+			return nil, fmt.Errorf("line %d: negative time, floor or elevator", lineNum)
+		}
+		calls = append(calls, Call{At: at, Floor: l.Floor, Button: button, Elevator: l.Elevator, Destination: l.Destination})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].At < calls[j].At })
+	return calls, nil
+}
+
+// Write writes `calls` as a JSONL scenario file.
+func Write(w io.Writer, calls []Call) error {
+	encoder := json.NewEncoder(w)
+	for _, c := range calls {
+		l := callLine{At: c.At.String(), Floor: c.Floor, Button: ButtonName(c.Button), Elevator: c.Elevator, Destination: c.Destination}
+		if err := encoder.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that all `calls` fit a building of `numFloors` floors and `numElevators` elevators.
+func Validate(calls []Call, numFloors int, numElevators int) error {
+	for i, c := range calls {
+		if c.Floor >= numFloors || (c.Destination != nil && *c.Destination >= numFloors) {
+			return fmt.Errorf("call %d: floor out of range in a building of %d floors", i, numFloors)
+		}
+		if c.Elevator >= numElevators {
+			return fmt.Errorf("call %d: elevator %d out of range", i, c.Elevator)
+		}
+		if (c.Floor == 0 && c.Button == elevio.BT_HallDown) || (c.Floor == numFloors-1 && c.Button == elevio.BT_HallUp) {
+			return fmt.Errorf("call %d: no %s button at floor %d", i, ButtonName(c.Button), c.Floor)
+		}
+	}
+	return nil
+}
+
+func (c Call) String() string {
+	kind := "cab call"
+	if c.Button != elevio.BT_Cab {
+		kind = "hall call"
+	}
+	return fmt.Sprintf("%s %+v pressed at %v", kind, elevio.ButtonEvent{Floor: c.Floor, Button: c.Button}, c.At)
+}
@@ -0,0 +1,119 @@
+package traffic
+
+import (
+	"elevator/clock"
+	"elevator/elevio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScenario_WriteThenRead(t *testing.T) {
+	destination := 3
+	calls := []Call{
+		{At: 1500 * time.Millisecond, Floor: 0, Button: elevio.BT_HallUp, Elevator: 1, Destination: &destination},
+		{At: time.Minute, Floor: 2, Button: elevio.BT_Cab},
+	}
+
+	var buf strings.Builder
+	if err := Write(&buf, calls); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, calls) {
+		t.Errorf("Read calls not as written.\nExpected: %+v\nWas: %+v", calls, read)
+	}
+}
+
+func TestScenario_ReadSortsAndRejects(t *testing.T) {
+	calls, err := Read(strings.NewReader(`# lunch at floor 2
+{"at": "10s", "floor": 2, "button": "hall_down", "destination": 0}
+
+{"at": "2s", "floor": 1, "button": "cab"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0].At != 2*time.Second || *calls[1].Destination != 0 {
+		t.Errorf("Expected 2 calls ordered by time, was %+v", calls)
+	}
+
+	for _, line := range []string{`{"at": "1s", "floor": 1, "button": "up"}`, `{"at": 5, "floor": 1, "button": "cab"}`, `{"at": "1s", "floor": -1, "button": "cab"}`} {
+		if _, err := Read(strings.NewReader(line)); err == nil {
+			t.Errorf("Expected %s to be rejected", line)
+		}
+	}
+}
+
+func TestProfile_UpPeakStartsAtTheLobby(t *testing.T) {
+	cfg := Config{Floors: 6, Elevators: 3, Duration: time.Hour, Rate: 10, Seed: 1}
+	calls := UpPeak.Generate(cfg)
+	if !reflect.DeepEqual(calls, UpPeak.Generate(cfg)) {
+		t.Error("Expected equal configs to generate equal traffic")
+	}
+	if len(calls) < 500 || len(calls) > 700 {
+		t.Errorf("Expected about 600 passengers in an hour, was %d", len(calls))
+	}
+	if err := Validate(calls, cfg.Floors, cfg.Elevators); err != nil {
+		t.Error(err)
+	}
+
+	fromLobby := 0
+	for _, c := range calls {
+		if c.Floor == lobby && c.Button == elevio.BT_HallUp {
+			fromLobby++
+		}
+		if *c.Destination == c.Floor {
+			t.Errorf("Passenger %v does not travel", c)
+		}
+	}
+	if share := float64(fromLobby) / float64(len(calls)); share < 0.8 {
+		t.Errorf("Expected most passengers to ride up from the lobby, was %.0f%%", share*100)
+	}
+}
+
+func TestPlay_PostsCallsToTheirElevator(t *testing.T) {
+	var received []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		body["path"] = r.URL.Path
+		received = append(received, body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				clk.Advance(time.Second)
+			}
+		}
+	}()
+	addrs := []string{"unused", strings.TrimPrefix(server.URL, "http://")}
+	calls := []Call{{At: 2 * time.Second, Floor: 1, Button: elevio.BT_HallUp, Elevator: 1}, {At: 5 * time.Second, Floor: 3, Button: elevio.BT_Cab, Elevator: 1}}
+	if err := Play(calls, clk, APIPresser(server.Client(), addrs)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []map[string]any{{"floor": 1.0, "button": "hall_up", "path": "/api/calls"}, {"floor": 3.0, "button": "cab", "path": "/api/calls"}}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Posted calls not as expected.\nExpected: %+v\nWas: %+v", expected, received)
+	}
+	if err := Play([]Call{{Elevator: 2}}, clk, APIPresser(server.Client(), addrs)); err == nil {
+		t.Error("Expected a call at an elevator without API address to fail")
+	}
+}
@@ -0,0 +1,277 @@
+package transport
+
+import (
+	"elevator/clock"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const receiveBufferSize = 256
+
+// reorderHoldTime is how long a datagram held back for reordering waits for the next one on its
+// link before it is delivered anyway.
+const reorderHoldTime = 20 * time.Millisecond
+
+// ErrDisconnected is returned when writing from a node which is disconnected from the network.
+var ErrDisconnected = errors.New("network is unreachable")
+
+// NetworkConfig describes the impairments of an in-memory Network. All random decisions are
+// drawn from a generator seeded with `Seed`, so equal seeds and equal traffic yield equal results.
+type NetworkConfig struct {
+	Seed          int64
+	LossRate      float64       // probability that a datagram is dropped per receiver
+	DuplicateRate float64       // probability that a datagram is delivered twice
+	ReorderRate   float64       // probability that a datagram is held back behind the next one, 20ms at most
+	Latency       time.Duration // base delivery delay
+	Jitter        time.Duration // maximum additional random delivery delay
+	Clock         clock.Clock   // times the delivery delays, the wall clock if nil
+}
+
+// Network is an in-memory broadcast medium for tests. Each elevator obtains its Transport
+// via `Node(id)`; the network can be impaired and partitioned at runtime.
+type Network struct {
+	mtx          sync.Mutex
+	cfg          NetworkConfig
+	rng          *rand.Rand
+	receivers    map[string][]*memoryReceiver
+	groups       map[int]int
+	disconnected map[int]bool
+}
+
+// NewNetwork creates an in-memory network with the impairments given in `cfg`.
+func NewNetwork(cfg NetworkConfig) *Network {
+	if cfg.Clock == nil {
+		cfg.Clock = clock.Real{}
+	}
+	return &Network{
+		cfg:          cfg,
+		rng:          rand.New(rand.NewSource(cfg.Seed)),
+		receivers:    make(map[string][]*memoryReceiver),
+		groups:       make(map[int]int),
+		disconnected: make(map[int]bool),
+	}
+}
+
+// Node returns the Transport used by the elevator with `id`.
+func (n *Network) Node(id int) Transport {
+	return &memoryNode{network: n, id: id}
+}
+
+// Configure replaces the impairments of the network. The seed of the running generator and the clock are kept.
+func (n *Network) Configure(cfg NetworkConfig) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	cfg.Seed = n.cfg.Seed
+	cfg.Clock = n.cfg.Clock
+	n.cfg = cfg
+}
+
+// Partition splits the network so datagrams are only delivered between nodes of the same group.
+// Nodes not mentioned in any group form a group of their own together.
+func (n *Network) Partition(groups ...[]int) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.groups = make(map[int]int)
+	for i, group := range groups {
+		for _, id := range group {
+			n.groups[id] = i + 1
+		}
+	}
+}
+
+// Heal removes all partitions.
+func (n *Network) Heal() {
+	n.Partition()
+}
+
+// Disconnect unplugs node `id` from the network. Its writes fail and it receives nothing,
+// not even its own datagrams.
+func (n *Network) Disconnect(id int) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.disconnected[id] = true
+}
+
+// Reconnect plugs node `id` back into the network.
+func (n *Network) Reconnect(id int) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	delete(n.disconnected, id)
+}
+
+// broadcast delivers a copy of `msg` from node `from` to every receiver listening on `port`.
+func (n *Network) broadcast(from int, port string, msg []byte) error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if n.disconnected[from] {
+		return ErrDisconnected
+	}
+	for _, r := range n.receivers[port] {
+		if n.groups[from] != n.groups[r.nodeID] || n.disconnected[r.nodeID] {
+			continue
+		}
+		if n.rng.Float64() < n.cfg.LossRate {
+			continue
+		}
+		copies := 1
+		if n.rng.Float64() < n.cfg.DuplicateRate {
+			copies = 2
+		}
+		for range copies {
+			datagram := append([]byte(nil), msg...)
+			delay := n.cfg.Latency
+			if n.cfg.Jitter > 0 {
+				delay += time.Duration(n.rng.Int63n(int64(n.cfg.Jitter)))
+			}
+
+			if r.held == nil && n.rng.Float64() < n.cfg.ReorderRate {
+				n.hold(r, datagram, delay)
+				continue
+			}
+			batch := [][]byte{datagram}
+			if r.held != nil {
+				batch = append(batch, r.held)
+				r.held = nil
+				r.release.Stop()
+			}
+			r.deliverAfter(n.cfg.Clock, delay, batch)
+		}
+	}
+	return nil
+}
+
+// Holds `datagram` back until the next datagram to `r` overtakes it, but at most `reorderHoldTime`
+// longer than `delay`. Must be called while holding `mtx`.
+func (n *Network) hold(r *memoryReceiver, datagram []byte, delay time.Duration) {
+	r.held = datagram
+	r.holds++
+	holds := r.holds
+	r.release = n.cfg.Clock.AfterFunc(delay+reorderHoldTime, func() {
+		n.mtx.Lock()
+		defer n.mtx.Unlock()
+
+		// Unless it was overtaken in the meantime
+		if r.held != nil && r.holds == holds {
+			r.deliverAfter(n.cfg.Clock, 0, [][]byte{r.held})
+			r.held = nil
+		}
+	})
+}
+
+// Removes `r` from the receivers on its port.
+func (n *Network) unregister(r *memoryReceiver) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	receivers := n.receivers[r.port]
+	for i, other := range receivers {
+		if other == r {
+			n.receivers[r.port] = append(receivers[:i:i], receivers[i+1:]...)
+			return
+		}
+	}
+}
+
+type memoryNode struct {
+	network *Network
+	id      int
+}
+
+func (m *memoryNode) Dial(port string) (io.WriteCloser, error) {
+	return &memorySender{node: m, port: port}, nil
+}
+
+func (m *memoryNode) Listen(port string) (io.ReadCloser, error) {
+	r := &memoryReceiver{
+		network: m.network,
+		nodeID:  m.id,
+		port:    port,
+		inbox:   make(chan []byte, receiveBufferSize),
+		done:    make(chan struct{}),
+	}
+
+	m.network.mtx.Lock()
+	m.network.receivers[port] = append(m.network.receivers[port], r)
+	m.network.mtx.Unlock()
+
+	return r, nil
+}
+
+type memorySender struct {
+	node   *memoryNode
+	port   string
+	closed atomic.Bool
+}
+
+func (s *memorySender) Write(msg []byte) (int, error) {
+	if s.closed.Load() {
+		return 0, io.ErrClosedPipe
+	}
+	if err := s.node.network.broadcast(s.node.id, s.port, msg); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
+func (s *memorySender) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+type memoryReceiver struct {
+	network *Network
+	nodeID  int
+	port    string
+	held    []byte      // datagram held back for reordering, guarded by network.mtx
+	holds   int         // number of datagrams held back so far, guarded by network.mtx
+	release clock.Timer // delivers `held` on a quiet link, guarded by network.mtx
+	inbox   chan []byte
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Delivers `batch` in order after `delay`. Like UDP, datagrams are dropped if the inbox is full.
+func (r *memoryReceiver) deliverAfter(clk clock.Clock, delay time.Duration, batch [][]byte) {
+	deliver := func() {
+		for _, datagram := range batch {
+			select {
+			case <-r.done:
+				return
+			case r.inbox <- datagram:
+			default:
+			}
+		}
+	}
+
+	if delay <= 0 {
+		deliver()
+		return
+	}
+	clk.AfterFunc(delay, deliver)
+}
+
+func (r *memoryReceiver) Read(buf []byte) (int, error) {
+	select {
+	case <-r.done:
+		return 0, io.EOF
+	case datagram := <-r.inbox:
+		return copy(buf, datagram), nil
+	}
+}
+
+func (r *memoryReceiver) Close() error {
+	r.once.Do(func() {
+		r.network.unregister(r)
+		close(r.done)
+	})
+	return nil
+}
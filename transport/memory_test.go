@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"elevator/clock"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testPort = "1"
+
+// Sends `count` single byte datagrams from node `from` and returns everything `receiver` got.
+func sendAndCollect(net *Network, from int, receiver io.ReadCloser, count int) []byte {
+	conn, _ := net.Node(from).Dial(testPort)
+	defer conn.Close()
+
+	for i := range count {
+		conn.Write([]byte{byte(i)})
+	}
+	return drain(receiver)
+}
+
+// Reads everything buffered in `r` without blocking.
+func drain(r io.ReadCloser) []byte {
+	received := make([]byte, 0)
+	inbox := r.(*memoryReceiver).inbox
+	for {
+		select {
+		case datagram := <-inbox:
+			received = append(received, datagram...)
+		default:
+			return received
+		}
+	}
+}
+
+func TestNetwork_DeliversToAllListeners(t *testing.T) {
+	net := NewNetwork(NetworkConfig{})
+	r0, _ := net.Node(0).Listen(testPort)
+	r1, _ := net.Node(1).Listen(testPort)
+
+	conn, _ := net.Node(0).Dial(testPort)
+	conn.Write([]byte{1, 2, 3})
+
+	for i, r := range []io.ReadCloser{r0, r1} {
+		buf := make([]byte, 8)
+		n, err := r.Read(buf)
+		if err != nil || !reflect.DeepEqual(buf[:n], []byte{1, 2, 3}) {
+			t.Errorf("Node %d received %v, %v", i, buf[:n], err)
+		}
+	}
+}
+
+func TestNetwork_FullLossDropsEverything(t *testing.T) {
+	net := NewNetwork(NetworkConfig{LossRate: 1})
+	r, _ := net.Node(1).Listen(testPort)
+
+	if received := sendAndCollect(net, 0, r, 100); len(received) != 0 {
+		t.Errorf("Expected no datagrams, received %d", len(received))
+	}
+}
+
+func TestNetwork_Duplication(t *testing.T) {
+	net := NewNetwork(NetworkConfig{DuplicateRate: 1})
+	r, _ := net.Node(1).Listen(testPort)
+
+	conn, _ := net.Node(0).Dial(testPort)
+	conn.Write([]byte{7})
+
+	if received := drain(r); !reflect.DeepEqual(received, []byte{7, 7}) {
+		t.Errorf("Expected duplicated datagram, received %v", received)
+	}
+}
+
+func TestNetwork_Reordering(t *testing.T) {
+	net := NewNetwork(NetworkConfig{ReorderRate: 1})
+	r, _ := net.Node(1).Listen(testPort)
+
+	conn, _ := net.Node(0).Dial(testPort)
+	conn.Write([]byte{1})
+	conn.Write([]byte{2})
+
+	if received := drain(r); !reflect.DeepEqual(received, []byte{2, 1}) {
+		t.Errorf("Expected reordered datagrams, received %v", received)
+	}
+}
+
+func TestNetwork_ReleasesHeldDatagramOnQuietLink(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	net := NewNetwork(NetworkConfig{ReorderRate: 1, Clock: clk})
+	r, _ := net.Node(1).Listen(testPort)
+
+	conn, _ := net.Node(0).Dial(testPort)
+	conn.Write([]byte{1})
+	if received := drain(r); len(received) != 0 {
+		t.Fatalf("Expected the datagram to be held back, received %v", received)
+	}
+
+	clk.Advance(reorderHoldTime)
+	if received := drain(r); !reflect.DeepEqual(received, []byte{1}) {
+		t.Errorf("Expected the held datagram to be delivered, received %v", received)
+	}
+}
+
+func TestNetwork_Partition(t *testing.T) {
+	net := NewNetwork(NetworkConfig{})
+	r1, _ := net.Node(1).Listen(testPort)
+	r2, _ := net.Node(2).Listen(testPort)
+	net.Partition([]int{0, 1}, []int{2})
+
+	conn, _ := net.Node(0).Dial(testPort)
+	conn.Write([]byte{1})
+	net.Heal()
+	conn.Write([]byte{2})
+
+	if received := drain(r1); !reflect.DeepEqual(received, []byte{1, 2}) {
+		t.Errorf("Expected node in same partition to receive all, received %v", received)
+	}
+	if received := drain(r2); !reflect.DeepEqual(received, []byte{2}) {
+		t.Errorf("Expected partitioned node to receive only after heal, received %v", received)
+	}
+}
+
+func TestNetwork_DeterministicFromSeed(t *testing.T) {
+	cfg := NetworkConfig{Seed: 42, LossRate: 0.5, DuplicateRate: 0.2, ReorderRate: 0.2}
+
+	run := func() []byte {
+		net := NewNetwork(cfg)
+		r, _ := net.Node(1).Listen(testPort)
+		return sendAndCollect(net, 0, r, 200)
+	}
+
+	first, second := run(), run()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Equal seeds produced different deliveries.\nFirst: %v\nSecond: %v", first, second)
+	}
+	if len(first) == 0 || len(first) >= 200 {
+		t.Errorf("Expected partial delivery at 50%% loss, received %d", len(first))
+	}
+}
+
+func TestNetwork_Disconnect(t *testing.T) {
+	net := NewNetwork(NetworkConfig{})
+	r0, _ := net.Node(0).Listen(testPort)
+	r1, _ := net.Node(1).Listen(testPort)
+	net.Disconnect(0)
+
+	conn, _ := net.Node(0).Dial(testPort)
+	if _, err := conn.Write([]byte{1}); err != ErrDisconnected {
+		t.Errorf("Expected write of disconnected node to fail, was %v", err)
+	}
+	peer, _ := net.Node(1).Dial(testPort)
+	peer.Write([]byte{2})
+	net.Reconnect(0)
+	conn.Write([]byte{3})
+
+	if received := drain(r0); !reflect.DeepEqual(received, []byte{3}) {
+		t.Errorf("Expected disconnected node to receive only after reconnect, received %v", received)
+	}
+	if received := drain(r1); !reflect.DeepEqual(received, []byte{2, 3}) {
+		t.Errorf("Expected connected node to receive all but the failed write, received %v", received)
+	}
+}
@@ -0,0 +1,13 @@
+package transport
+
+import "io"
+
+// Transport delivers broadcast datagrams between elevators. Every datagram written to a
+// connection returned by `Dial(port)` is delivered to all connections returned by `Listen(port)`,
+// including the sender's own.
+type Transport interface {
+	// Dial opens a connection which broadcasts each write as one datagram on `port`.
+	Dial(port string) (io.WriteCloser, error)
+	// Listen opens a connection where each read returns one datagram received on `port`.
+	Listen(port string) (io.ReadCloser, error)
+}
@@ -0,0 +1,25 @@
+package transport
+
+import (
+	"io"
+	"net"
+)
+
+const broadcastAddr = "255.255.255.255"
+
+// UDP is the Transport used in production. It broadcasts datagrams on the local network.
+type UDP struct{}
+
+// Dial opens a UDP connection to the broadcast address on `port`.
+func (UDP) Dial(port string) (io.WriteCloser, error) {
+	return net.Dial("udp", broadcastAddr+":"+port)
+}
+
+// Listen binds a UDP socket receiving broadcasts on `port`.
+func (UDP) Listen(port string) (io.ReadCloser, error) {
+	addr, err := net.ResolveUDPAddr("udp", broadcastAddr+":"+port)
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenUDP("udp", addr)
+}
@@ -1,10 +1,62 @@
 package types
 
-import "elevator/elevio"
+import (
+	"elevator/elevio"
+	"fmt"
+)
 
+// ElevatorState is the state of an elevator as seen by the assigner and other elevators.
 type ElevatorState interface {
 	GetID() int
 	GetFloor() int
 	GetDirection() elevio.MotorDirection
 	GetRequests() [][3]bool
+	GetAvailability() Availability
+	GetBehaviour() Behaviour
+	IsDoorOpen() bool
+	IsObstructed() bool
+	IsBetweenFloors() bool
+	GetCapacity() int // passengers the car takes, 0 if unknown
+}
+
+// Behaviour of the control loop of an elevator.
+type Behaviour int
+
+const (
+	BH_Idle     Behaviour = 0
+	BH_Moving   Behaviour = 1
+	BH_DoorOpen Behaviour = 2
+)
+
+func (b Behaviour) String() string {
+	switch b {
+	case BH_Idle:
+		return "idle"
+	case BH_Moving:
+		return "moving"
+	case BH_DoorOpen:
+		return "door_open"
+	}
+	return fmt.Sprintf("Behaviour(%d)", int(b))
+}
+
+// Availability of an elevator for serving hall calls, advertised to other elevators.
+type Availability int
+
+const (
+	AV_Available    Availability = 0 // serves hall calls normally
+	AV_Degraded     Availability = 1 // temporarily impaired, e.g. obstructed, and might recover soon
+	AV_OutOfService Availability = 2 // cannot serve hall calls until further notice
+)
+
+func (a Availability) String() string {
+	switch a {
+	case AV_Available:
+		return "available"
+	case AV_Degraded:
+		return "degraded"
+	case AV_OutOfService:
+		return "out-of-service"
+	}
+	return fmt.Sprintf("Availability(%d)", int(a))
 }